@@ -0,0 +1,57 @@
+// Copyright ©2023 The aranet4 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package aranet4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Layout of the manufacturer-specific data advertised by Aranet4:
+//
+//	[0:2]   company identifier (manufacturerID, little-endian)
+//	[2]     flags; bit 5 is set when "Smart Home integration" is enabled
+//	[3:10]  firmware version and reserved bytes
+//	[10:23] current readings, same layout as the uuidReadAll characteristic
+//	[23]    measurement counter
+//
+// Readings are only present when "Smart Home integration" is enabled.
+const (
+	advFlagsOffset = 2
+	advDataOffset  = 10
+	advDataSize    = 13
+
+	advFlagIntegration = 1 << 5
+)
+
+// DecodeAdvertisement decodes the current readings broadcast by an
+// Aranet4 in its advertisement manufacturer data, as returned by
+// ble.Advertisement.ManufacturerData (i.e. including the company identifier).
+//
+// DecodeAdvertisement returns ErrNoData if the device does not broadcast
+// its readings, which requires "Smart Home integration" to be enabled.
+func DecodeAdvertisement(manufacturerData []byte) (Data, error) {
+	var (
+		data Data
+		p    = manufacturerData
+	)
+	if len(p) < advFlagsOffset+1 {
+		return data, fmt.Errorf("aranet4: invalid manufacturer data %q", p)
+	}
+	if id := binary.LittleEndian.Uint16(p); id != manufacturerID {
+		return data, fmt.Errorf("aranet4: invalid manufacturer id 0x%04x", id)
+	}
+	if p[advFlagsOffset]&advFlagIntegration == 0 || len(p) < advDataOffset+advDataSize {
+		return data, fmt.Errorf("aranet4: smart home integration disabled: %w", ErrNoData)
+	}
+
+	dec := newDecoder(bytes.NewReader(p[advDataOffset : advDataOffset+advDataSize]))
+	err := dec.readData(&data)
+	if err != nil {
+		return data, fmt.Errorf("could not decode advertised data: %w", err)
+	}
+	return data, nil
+}
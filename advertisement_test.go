@@ -0,0 +1,83 @@
+// Copyright ©2023 The aranet4 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package aranet4
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+var (
+	// advEnabled is the manufacturer data of an Aranet4 with "Smart Home
+	// integration" enabled, advertising testSample measured 10s ago.
+	advEnabled = []byte{
+		0x02, 0x07, // company identifier: SAF Tehnika
+		0x22,                                     // flags: integration enabled
+		0x01, 0x00, 0x0c, 0x01, 0x00, 0x00, 0x00, // firmware version, reserved
+		0x2c, 0x03, // CO2: 812 ppm
+		0xab, 0x01, // T: 21.35°C
+		0x94, 0x27, // P: 1013.2 hPa
+		0x29,       // H: 41%
+		0x57,       // battery: 87%
+		0x01,       // quality: green
+		0x2c, 0x01, // interval: 300s
+		0x0a, 0x00, // ago: 10s
+		0x2a, // measurement counter
+	}
+
+	// advDisabled is the manufacturer data of an Aranet4 with "Smart Home
+	// integration" disabled, which carries no readings.
+	advDisabled = []byte{
+		0x02, 0x07, // company identifier: SAF Tehnika
+		0x02,                                     // flags: integration disabled
+		0x01, 0x00, 0x0c, 0x01, 0x00, 0x00, 0x00, // firmware version, reserved
+	}
+)
+
+func TestDecodeAdvertisement(t *testing.T) {
+	got, err := DecodeAdvertisement(advEnabled)
+	if err != nil {
+		t.Fatalf("could not decode advertisement: %+v", err)
+	}
+	assertNear(t, "time-stamp", got.Time, time.Now().Add(-10*time.Second))
+
+	want := testSample()
+	want.Time = got.Time
+	if got != want {
+		t.Fatalf("invalid data:\ngot= %+v\nwant=%+v", got, want)
+	}
+}
+
+func TestDecodeAdvertisementErrors(t *testing.T) {
+	enabled := advEnabled
+	for _, tc := range []struct {
+		name    string
+		raw     []byte
+		noData  bool
+		invalid bool
+	}{
+		{name: "integration-disabled", raw: advDisabled, noData: true},
+		{name: "integration-disabled-readings", raw: append(slices.Clone(advDisabled), advEnabled[advDataOffset:]...), noData: true},
+		{name: "no-readings", raw: enabled[:advDataOffset], noData: true},
+		{name: "truncated-readings", raw: enabled[:advDataOffset+advDataSize-1], noData: true},
+		{name: "manufacturer-id", raw: append([]byte{0x4c, 0x00}, enabled[2:]...), invalid: true},
+		{name: "short", raw: enabled[:2], invalid: true},
+		{name: "empty", raw: nil, invalid: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := DecodeAdvertisement(tc.raw)
+			switch {
+			case err == nil:
+				t.Fatalf("expected an error")
+			case tc.noData && !errors.Is(err, ErrNoData):
+				t.Fatalf("invalid error: got=%+v, want=%v", err, ErrNoData)
+			case tc.invalid && errors.Is(err, ErrNoData):
+				t.Fatalf("invalid error: got=%+v, want a decoding error", err)
+			}
+		})
+	}
+}
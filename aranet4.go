@@ -9,6 +9,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -27,6 +29,8 @@ var (
 	uuidReadTimeSeries         = "f0cd2003-95da-4f4b-9ac8-aa55d312af0c"
 	uuidReadSecondsSinceUpdate = "f0cd2004-95da-4f4b-9ac8-aa55d312af0c"
 	uuidReadTotalReadings      = "f0cd2001-95da-4f4b-9ac8-aa55d312af0c"
+	uuidReadSampleAranet2      = "f0cd1504-95da-4f4b-9ac8-aa55d312af0c"
+	uuidReadSensorState        = "f0cd1401-95da-4f4b-9ac8-aa55d312af0c"
 
 	uuidGenericService = "00001800-0000-1000-8000-00805f9b34fb"
 
@@ -47,17 +51,46 @@ const (
 	paramCO2 = 4
 )
 
+// commands written to the uuidWriteCmd characteristic.
+const (
+	cmdReadHistory   = 0x82
+	cmdSetInterval   = 0x90
+	cmdSetBuzzer     = 0x94
+	cmdCalibrate     = 0x95
+	cmdSetThresholds = 0x96
+)
+
 var (
 	// ErrNoData indicates a missing data point.
 	// This may happen during sensor calibration.
 	ErrNoData = errors.New("aranet4: no data")
 
+	// ErrInvalidData indicates a data sample with values outside of
+	// physical bounds, usually caused by a corrupt or partial read.
+	ErrInvalidData = errors.New("aranet4: invalid data")
+
+	// ErrDeviceNotFound is returned by New when the device could not be
+	// found while scanning, e.g. because it is out of range or the
+	// address is wrong.
+	ErrDeviceNotFound = errors.New("aranet4: device not found")
+
+	// ErrConnectTimeout is returned by New when the device was found but
+	// the connection could not be established in time.
+	ErrConnectTimeout = errors.New("aranet4: connection timeout")
+
+	// ErrClosed is returned by the methods of a Device after Close, or
+	// after a canceled context aborted one of its operations.
+	ErrClosed = errors.New("aranet4: device closed")
+
 	// ErrDupDevice is returned by DB.AddDevice when a device with
 	// the provided id is already stored in the database.
 	ErrDupDevice = errors.New("aranet4: duplicate device")
 
 	// errNoSvc indicates to service could be found for a given device.
 	errNoSvc = errors.New("aranet4: no service attached to device")
+
+	// errNoChar indicates a characteristic is missing from the device profile.
+	errNoChar = errors.New("aranet4: characteristic not found")
 )
 
 // Quality gives a general assessment of air quality (green/yellow/red).
@@ -79,6 +112,95 @@ func (st Quality) String() string {
 	}
 }
 
+// MarshalText implements encoding.TextMarshaler.
+// Known qualities are encoded as "green", "yellow" or "red", other
+// values as their decimal representation.
+func (st Quality) MarshalText() ([]byte, error) {
+	switch st {
+	case 1, 2, 3:
+		return []byte(st.String()), nil
+	default:
+		return strconv.AppendInt(nil, int64(st), 10), nil
+	}
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (st *Quality) UnmarshalText(p []byte) error {
+	switch string(p) {
+	case "green":
+		*st = 1
+	case "yellow":
+		*st = 2
+	case "red":
+		*st = 3
+	default:
+		v, err := strconv.Atoi(string(p))
+		if err != nil {
+			return fmt.Errorf("aranet4: invalid quality %q", p)
+		}
+		*st = Quality(v)
+	}
+	return nil
+}
+
+// Model identifies the kind of Aranet device.
+type Model int
+
+const (
+	Aranet4 Model = iota // CO2, temperature, humidity and pressure
+	Aranet2              // temperature and humidity only
+
+	UnknownModel Model = -1 // unrecognized or undetected model
+)
+
+func (m Model) String() string {
+	switch m {
+	case Aranet4:
+		return "aranet4"
+	case Aranet2:
+		return "aranet2"
+	case UnknownModel:
+		return "unknown"
+	default:
+		return fmt.Sprintf("Model(%d)", int(m))
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (m Model) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (m *Model) UnmarshalText(p []byte) error {
+	switch string(p) {
+	case "aranet4":
+		*m = Aranet4
+	case "aranet2":
+		*m = Aranet2
+	case "unknown":
+		*m = UnknownModel
+	default:
+		return fmt.Errorf("aranet4: invalid model %q", p)
+	}
+	return nil
+}
+
+// ModelFrom returns the model described by a model-number string, as
+// exposed by the device information service.
+// ModelFrom returns UnknownModel for unrecognized model numbers, such as
+// those of other SAF Tehnika devices.
+func ModelFrom(number string) Model {
+	switch {
+	case strings.Contains(number, "Aranet4"):
+		return Aranet4
+	case strings.Contains(number, "Aranet2"):
+		return Aranet2
+	default:
+		return UnknownModel
+	}
+}
+
 // QualityFrom creates a quality value from a CO2 value.
 func QualityFrom(co2 int) Quality {
 	switch {
@@ -92,18 +214,67 @@ func QualityFrom(co2 int) Quality {
 }
 
 // Data holds measured data samples provided by Aranet4.
+//
+// Absent values are marked with sentinels: -1 for CO2 and pressure, and
+// NaN for temperature. Quality is zero when CO2 is absent.
+// Samples from Aranet2 devices, as indicated by Model, hold no CO2 nor
+// pressure, and history samples may miss values the device did not
+// record. Battery is -1 for history samples.
 type Data struct {
 	H, P, T float64
 	CO2     int
 	Battery int
 	Quality Quality
+	Model   Model
 
 	Interval time.Duration
 	Time     time.Time
 }
 
+// BinaryVersion is the version of the binary encoding written by
+// Data.Marshal.
+//
+// Version 2 is laid out as follows, multi-byte values being little-endian:
+//
+//	[0]     version (2)
+//	[1:9]   time-stamp, in seconds since the Unix epoch (int64)
+//	[9]     model (int8)
+//	[10:12] humidity, in 1/10 % (uint16)
+//	[12:14] pressure, in 1/10 hPa, 0xffff when absent (uint16)
+//	[14:16] temperature, in 1/100 °C, -32768 when absent (int16)
+//	[16:18] CO2, in ppm, 0xffff when absent (uint16)
+//	[18]    battery, in %, -1 when unknown (int8)
+//	[19]    interval, in minutes (uint8)
+//
+// Version 1 only holds Aranet4 samples:
+//
+//	[0]     version (1)
+//	[1:9]   time-stamp, in seconds since the Unix epoch (int64)
+//	[9]     humidity, in % (uint8)
+//	[10:12] pressure, in 1/10 hPa (uint16)
+//	[12:14] temperature, in 1/100 °C (int16)
+//	[14:16] CO2, in ppm (uint16)
+//	[16]    battery, in %, -1 when unknown (int8)
+//	[17]    interval, in minutes (uint8)
+//
+// Version 0 is the version 1 layout without the leading version byte.
+// When decoding versions 0 and 1, a CO2 or pressure of 0xffff, and a
+// temperature of -32768, are reported as absent.
+// Quality is not stored: it is derived from CO2 when decoding.
+//
+// The encoding of a given version never changes: new fields are added
+// with a new version, and Data.Unmarshal keeps decoding older ones.
+const BinaryVersion = 2
+
 // keep dataSize synchronized with Data.
-const dataSize = 17
+const (
+	dataSizeV0 = 17             // unversioned encoding
+	dataSizeV1 = 1 + dataSizeV0 // version byte + version 0 payload
+	dataSize   = 20             // current encoding
+
+	binNoValue = math.MaxUint16 // absent CO2 or pressure
+	binNoTemp  = math.MinInt16  // absent temperature
+)
 
 // BinarySize returns the number of bytes needed to hold the binary data
 // for a single Data element.
@@ -111,45 +282,268 @@ func (Data) BinarySize() int {
 	return dataSize
 }
 
+// Validate checks that the sample holds physically plausible values:
+//   - CO2:         [0, 40000] ppm
+//   - temperature: [-40, 85] °C
+//   - humidity:    [0, 100] %
+//   - pressure:    [300, 1100] hPa
+//   - battery:     [0, 100] %, or -1 when unknown
+//
+// CO2 and pressure are not checked for Aranet2 samples, nor are absent
+// values of history samples.
+// Validate returns all violations, wrapping ErrInvalidData.
+func (data Data) Validate() error {
+	var errs []error
+	if data.Model != Aranet2 {
+		if data.CO2 != -1 && !(0 <= data.CO2 && data.CO2 <= 40000) {
+			errs = append(errs, fmt.Errorf("%w: CO2 %d ppm out of range", ErrInvalidData, data.CO2))
+		}
+		if data.P != -1 && !(300 <= data.P && data.P <= 1100) {
+			errs = append(errs, fmt.Errorf("%w: pressure %g hPa out of range", ErrInvalidData, data.P))
+		}
+	}
+	if !math.IsNaN(data.T) && !(-40 <= data.T && data.T <= 85) {
+		errs = append(errs, fmt.Errorf("%w: temperature %g°C out of range", ErrInvalidData, data.T))
+	}
+	if !(0 <= data.H && data.H <= 100) {
+		errs = append(errs, fmt.Errorf("%w: humidity %g%% out of range", ErrInvalidData, data.H))
+	}
+	if !(-1 <= data.Battery && data.Battery <= 100) {
+		errs = append(errs, fmt.Errorf("%w: battery %d%% out of range", ErrInvalidData, data.Battery))
+	}
+	return errors.Join(errs...)
+}
+
+// TemperatureF returns the temperature in degrees Fahrenheit.
+func (data Data) TemperatureF() float64 {
+	return data.T*9/5 + 32
+}
+
+// TemperatureK returns the temperature in Kelvin.
+func (data Data) TemperatureK() float64 {
+	return data.T + 273.15
+}
+
+// String returns a multi-line, human readable, representation of the
+// sample, one labelled field per line:
+//
+//	CO2:         800 ppm
+//	temperature: 21.5°C
+//	pressure:    1013.2 hPa
+//	humidity:    40%
+//	quality:     green
+//	battery:     90%
+//	interval:    5m0s
+//	time-stamp:  2006-01-02 15:04:05 UTC
+//	age:         1m30s
+//
+// The age is the time elapsed since the time-stamp, to the second.
+// The labels and their order are stable.
+// Absent values, such as the CO2, pressure and quality of Aranet2
+// samples, or the gaps of history samples, are shown as "n/a".
+// Use Line for a compact, single-line, representation.
 func (data Data) String() string {
+	co2, t, p, q := data.textValues()
 	var o strings.Builder
-	fmt.Fprintf(&o, "CO2:         %d ppm\n", data.CO2)
-	fmt.Fprintf(&o, "temperature: %g°C\n", data.T)
-	fmt.Fprintf(&o, "pressure:    %g hPa\n", data.P)
+	fmt.Fprintf(&o, "CO2:         %s\n", withUnit(co2, " ppm"))
+	fmt.Fprintf(&o, "temperature: %s\n", withUnit(t, "°C"))
+	fmt.Fprintf(&o, "pressure:    %s\n", withUnit(p, " hPa"))
 	fmt.Fprintf(&o, "humidity:    %g%%\n", data.H)
-	fmt.Fprintf(&o, "quality:     %v\n", data.Quality)
+	fmt.Fprintf(&o, "quality:     %s\n", q)
 	fmt.Fprintf(&o, "battery:     %d%%\n", data.Battery)
 	fmt.Fprintf(&o, "interval:    %v\n", data.Interval)
 	fmt.Fprintf(&o, "time-stamp:  %v\n", data.Time.UTC().Format(timeFmt))
+	fmt.Fprintf(&o, "age:         %s\n", data.age())
 	return o.String()
 }
 
+// Line returns a compact, single-line, representation of the sample:
+//
+//	2006-01-02 15:04:05 UTC CO2=800ppm T=21.5°C H=40% P=1013.2hPa battery=90% quality=green age=1m30s
+//
+// The time-stamp always comes first, followed by labelled fields in a
+// stable order.
+// Absent values are shown as "n/a", as with String.
+func (data Data) Line() string {
+	co2, t, p, q := data.textValues()
+	return fmt.Sprintf(
+		"%s CO2=%s T=%s H=%g%% P=%s battery=%d%% quality=%s age=%s",
+		data.Time.UTC().Format(timeFmt),
+		withUnit(co2, "ppm"), withUnit(t, "°C"), data.H, withUnit(p, "hPa"), data.Battery, q,
+		data.age(),
+	)
+}
+
+// timeNow returns the current time.
+// It is replaced in tests.
+var timeNow = time.Now
+
+// age returns the time elapsed since the sample was measured, as text,
+// or notAvailable if the sample has no time-stamp.
+func (data Data) age() string {
+	if data.Time.IsZero() {
+		return notAvailable
+	}
+	return timeNow().Sub(data.Time).Round(time.Second).String()
+}
+
+// notAvailable is the text representation of absent values.
+const notAvailable = "n/a"
+
+// textValues returns the CO2, temperature, pressure and quality of the
+// sample as text, without units, or notAvailable for absent values.
+func (data Data) textValues() (co2, t, p, q string) {
+	co2, t, p, q = notAvailable, notAvailable, notAvailable, notAvailable
+	if data.CO2 != -1 {
+		co2 = strconv.Itoa(data.CO2)
+		q = data.Quality.String()
+	}
+	if !math.IsNaN(data.T) {
+		t = strconv.FormatFloat(data.T, 'g', -1, 64)
+	}
+	if data.P != -1 {
+		p = strconv.FormatFloat(data.P, 'g', -1, 64)
+	}
+	return co2, t, p, q
+}
+
+// withUnit appends unit to the text value v, unless it is absent.
+func withUnit(v, unit string) string {
+	if v == notAvailable {
+		return v
+	}
+	return v + unit
+}
+
+// Unmarshal decodes a sample from its binary representation, as
+// written by Marshal.
+// Unmarshal also accepts the encodings of older versions, including the
+// legacy, unversioned, 17-byte encoding.
 func (data *Data) Unmarshal(p []byte) error {
-	if len(p) != dataSize {
+	switch {
+	case len(p) == dataSizeV0:
+		return data.unmarshalV0(p)
+	case len(p) == dataSizeV1 && p[0] == 1:
+		return data.unmarshalV0(p[1:])
+	case len(p) == dataSize && p[0] == 2:
+		return data.unmarshalV2(p[1:])
+	case len(p) == dataSizeV1, len(p) == dataSize:
+		return fmt.Errorf("aranet4: unknown binary encoding version %d", p[0])
+	default:
 		return io.ErrShortBuffer
 	}
-	data.Time = time.Unix(int64(binary.LittleEndian.Uint64(p)), 0).UTC()
-	data.H = float64(p[8])
-	data.P = float64(binary.LittleEndian.Uint16(p[9:])) / 10
-	data.T = float64(binary.LittleEndian.Uint16(p[11:])) / 100
-	data.CO2 = int(binary.LittleEndian.Uint16(p[13:]))
-	data.Battery = int(p[15])
+}
+
+func (data *Data) unmarshalV0(p []byte) error {
+	*data = Data{
+		Time:     time.Unix(int64(binary.LittleEndian.Uint64(p)), 0).UTC(),
+		H:        float64(p[8]),
+		P:        float64(binary.LittleEndian.Uint16(p[9:])) / 10,
+		T:        unmarshalTemp(p[11:]),
+		CO2:      int(binary.LittleEndian.Uint16(p[13:])),
+		Battery:  int(int8(p[15])),
+		Interval: time.Duration(p[16]) * time.Minute,
+		Model:    Aranet4,
+	}
+	// versions 0 and 1 had no sentinel: map values that version 2 can
+	// not represent to absent ones.
+	if data.P == binNoValue/10.0 {
+		data.P = -1
+	}
+	if data.CO2 == binNoValue {
+		data.CO2 = -1
+		return nil
+	}
 	data.Quality = QualityFrom(data.CO2)
-	data.Interval = time.Duration(p[16]) * time.Minute
 	return nil
 }
 
+func (data *Data) unmarshalV2(p []byte) error {
+	*data = Data{
+		Time:     time.Unix(int64(binary.LittleEndian.Uint64(p)), 0).UTC(),
+		Model:    Model(int8(p[8])),
+		H:        float64(binary.LittleEndian.Uint16(p[9:])) / 10,
+		P:        -1,
+		T:        unmarshalTemp(p[13:]),
+		CO2:      -1,
+		Battery:  int(int8(p[17])),
+		Interval: time.Duration(p[18]) * time.Minute,
+	}
+	if v := binary.LittleEndian.Uint16(p[11:]); v != binNoValue {
+		data.P = float64(v) / 10
+	}
+	if v := binary.LittleEndian.Uint16(p[15:]); v != binNoValue {
+		data.CO2 = int(v)
+		data.Quality = QualityFrom(data.CO2)
+	}
+	return nil
+}
+
+// unmarshalTemp decodes a temperature in 1/100 °C, binNoTemp being
+// decoded as NaN.
+func unmarshalTemp(p []byte) float64 {
+	v := int16(binary.LittleEndian.Uint16(p))
+	if v == binNoTemp {
+		return math.NaN()
+	}
+	return float64(v) / 100
+}
+
+// Marshal encodes the sample into p, which must be BinarySize bytes long,
+// using the BinaryVersion encoding.
+//
+// Temperature and battery are stored as signed values, to support
+// sub-zero temperatures and the -1 battery level of history samples.
+// Absent values (see Data) are stored as such.
+// Marshal returns an error if a field does not fit in its binary
+// representation, instead of silently wrapping it.
 func (data Data) Marshal(p []byte) error {
 	if len(p) != dataSize {
 		return io.ErrShortBuffer
 	}
+	var (
+		h   = math.Round(data.H * 10)
+		pr  = math.Round(data.P * 10)
+		t   = math.Round(data.T * 100)
+		co2 = data.CO2
+		itv = data.Interval / time.Minute
+	)
+	if data.P == -1 {
+		pr = binNoValue
+	}
+	if data.CO2 == -1 {
+		co2 = binNoValue
+	}
+	if math.IsNaN(data.T) {
+		t = binNoTemp
+	}
+	switch {
+	case !(math.MinInt8 <= data.Model && data.Model <= math.MaxInt8):
+		return fmt.Errorf("aranet4: model %v out of range", data.Model)
+	case !(0 <= h && h <= math.MaxUint16):
+		return fmt.Errorf("aranet4: humidity %g%% out of range", data.H)
+	case !(0 <= pr && pr <= binNoValue) || (pr == binNoValue && data.P != -1):
+		return fmt.Errorf("aranet4: pressure %g hPa out of range", data.P)
+	case !(binNoTemp <= t && t <= math.MaxInt16) || (t == binNoTemp && !math.IsNaN(data.T)):
+		return fmt.Errorf("aranet4: temperature %g°C out of range", data.T)
+	case !(0 <= co2 && co2 <= binNoValue) || (co2 == binNoValue && data.CO2 != -1):
+		return fmt.Errorf("aranet4: CO2 %d ppm out of range", data.CO2)
+	case !(math.MinInt8 <= data.Battery && data.Battery <= math.MaxInt8):
+		return fmt.Errorf("aranet4: battery %d%% out of range", data.Battery)
+	case !(0 <= itv && itv <= math.MaxUint8):
+		return fmt.Errorf("aranet4: interval %v out of range", data.Interval)
+	}
+
+	p[0] = BinaryVersion
+	p = p[1:]
 	binary.LittleEndian.PutUint64(p[0:], uint64(data.Time.UTC().Unix()))
-	p[8] = uint8(data.H)
-	binary.LittleEndian.PutUint16(p[9:], uint16(data.P*10))
-	binary.LittleEndian.PutUint16(p[11:], uint16(data.T*100))
-	binary.LittleEndian.PutUint16(p[13:], uint16(data.CO2))
-	p[15] = uint8(data.Battery)
-	p[16] = uint8(data.Interval.Minutes())
+	p[8] = uint8(int8(data.Model))
+	binary.LittleEndian.PutUint16(p[9:], uint16(h))
+	binary.LittleEndian.PutUint16(p[11:], uint16(pr))
+	binary.LittleEndian.PutUint16(p[13:], uint16(int16(t)))
+	binary.LittleEndian.PutUint16(p[15:], uint16(co2))
+	p[17] = uint8(int8(data.Battery))
+	p[18] = uint8(itv)
 	return nil
 }
 
@@ -164,10 +558,101 @@ func (vs Samples) Len() int           { return len(vs) }
 func (vs Samples) Swap(i, j int)      { vs[i], vs[j] = vs[j], vs[i] }
 func (vs Samples) Less(i, j int) bool { return ltApprox(vs[i], vs[j]) }
 
+// Stats holds summary statistics of a measured quantity.
+type Stats struct {
+	Min, Max, Mean float64
+	N              int // number of samples holding a value
+}
+
+// Stats returns summary statistics of the quantity extracted by fn from
+// each sample.
+// Samples for which fn returns NaN are absent and skipped.
+// Stats returns a zero Stats value if no sample is left.
+func (vs Samples) Stats(fn func(Data) float64) Stats {
+	st := Stats{
+		Min: math.Inf(+1),
+		Max: math.Inf(-1),
+	}
+	sum := 0.0
+	for _, v := range vs {
+		x := fn(v)
+		if math.IsNaN(x) {
+			continue
+		}
+		st.Min = math.Min(st.Min, x)
+		st.Max = math.Max(st.Max, x)
+		sum += x
+		st.N++
+	}
+	if st.N == 0 {
+		return Stats{}
+	}
+	st.Mean = sum / float64(st.N)
+	return st
+}
+
+// absent returns NaN if x is the -1 sentinel of absent values, and x
+// otherwise.
+func absent(x float64) float64 {
+	if x == -1 {
+		return math.NaN()
+	}
+	return x
+}
+
+// CO2Stats returns summary statistics of the CO2 concentration, in ppm.
+func (vs Samples) CO2Stats() Stats {
+	return vs.Stats(func(v Data) float64 { return absent(float64(v.CO2)) })
+}
+
+// TStats returns summary statistics of the temperature, in °C.
+func (vs Samples) TStats() Stats {
+	return vs.Stats(func(v Data) float64 { return v.T })
+}
+
+// HStats returns summary statistics of the humidity, in %.
+func (vs Samples) HStats() Stats {
+	return vs.Stats(func(v Data) float64 { return v.H })
+}
+
+// PStats returns summary statistics of the pressure, in hPa.
+func (vs Samples) PStats() Stats {
+	return vs.Stats(func(v Data) float64 { return absent(v.P) })
+}
+
 const (
 	timeResolution int64 = 5 // seconds
 )
 
+// InferInterval returns the most frequent spacing between consecutive
+// samples of vs, which must be sorted by increasing time-stamps.
+// Spacings are rounded to the time resolution of samples, and spacings
+// below that resolution (duplicates) are ignored.
+// InferInterval returns 0 if vs holds less than two distinct samples.
+func InferInterval(vs []Data) time.Duration {
+	if len(vs) < 2 {
+		return 0
+	}
+
+	var (
+		hist = make(map[int64]int)
+		mode int64
+	)
+	for i := 1; i < len(vs); i++ {
+		dt := vs[i].Time.Unix() - vs[i-1].Time.Unix()
+		if dt < timeResolution {
+			continue
+		}
+		dt = (dt + timeResolution/2) / timeResolution * timeResolution
+		hist[dt]++
+		switch n := hist[dt]; {
+		case n > hist[mode], n == hist[mode] && dt < mode:
+			mode = dt
+		}
+	}
+	return time.Duration(mode) * time.Second
+}
+
 func ltApprox(a, b Data) bool {
 	at := a.Time.UTC().Unix()
 	bt := b.Time.UTC().Unix()
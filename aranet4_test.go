@@ -0,0 +1,406 @@
+// Copyright ©2023 The aranet4 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package aranet4
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSampleAranet2 returns a plausible Aranet2 sample.
+func testSampleAranet2() Data {
+	return Data{
+		H:        45.3,
+		P:        -1,
+		T:        -5.25,
+		CO2:      -1,
+		Battery:  95,
+		Interval: time.Minute,
+		Time:     time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC),
+		Model:    Aranet2,
+	}
+}
+
+// testSampleGap returns a history sample missing its temperature and
+// CO2, as recorded during a calibration.
+func testSampleGap() Data {
+	v := testSample()
+	v.T = math.NaN()
+	v.CO2 = -1
+	v.Quality = 0
+	v.Battery = -1
+	return v
+}
+
+// sameData reports whether a and b are equal, absent temperatures
+// comparing equal.
+func sameData(a, b Data) bool {
+	if math.IsNaN(a.T) && math.IsNaN(b.T) {
+		a.T, b.T = 0, 0
+	}
+	return a == b
+}
+
+func TestDataBinaryRoundTrip(t *testing.T) {
+	for _, want := range []Data{
+		testSample(),
+		testSampleAranet2(),
+		testSampleGap(),
+		{Time: time.Unix(0, 0).UTC(), T: 20, P: 1000, CO2: 400, Battery: -1, Quality: 1, Model: UnknownModel},
+	} {
+		t.Run(want.Model.String(), func(t *testing.T) {
+			p := make([]byte, want.BinarySize())
+			err := want.Marshal(p)
+			if err != nil {
+				t.Fatalf("could not marshal data: %+v", err)
+			}
+			if p[0] != BinaryVersion {
+				t.Fatalf("invalid version: got=%d, want=%d", p[0], BinaryVersion)
+			}
+			var got Data
+			err = got.Unmarshal(p)
+			if err != nil {
+				t.Fatalf("could not unmarshal data: %+v", err)
+			}
+			if !sameData(got, want) {
+				t.Fatalf("invalid round-trip:\ngot= %+v\nwant=%+v", got, want)
+			}
+			if want.Model != UnknownModel {
+				if err := got.Validate(); err != nil {
+					t.Fatalf("invalid round-trip data: %+v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestDataUnmarshal(t *testing.T) {
+	var (
+		// 2023-01-02T03:04:05Z, H=41%, P=1013.2 hPa, T=21.35°C, CO2=812 ppm,
+		// battery=87%, interval=5min.
+		v0 = []byte{
+			0xa5, 0x49, 0xb2, 0x63, 0, 0, 0, 0,
+			0x29, 0x94, 0x27, 0x57, 0x08, 0x2c, 0x03, 0x57, 0x05,
+		}
+		v1 = append([]byte{1}, v0...)
+		v2 = []byte{
+			2,
+			0xa5, 0x49, 0xb2, 0x63, 0, 0, 0, 0,
+			0x00,       // model: Aranet4
+			0x9a, 0x01, // H: 41.0%
+			0x94, 0x27, // P: 1013.2 hPa
+			0x57, 0x08, // T: 21.35°C
+			0x2c, 0x03, // CO2: 812 ppm
+			0x57, 0x05,
+		}
+		v2Aranet2 = []byte{
+			2,
+			0xa5, 0x49, 0xb2, 0x63, 0, 0, 0, 0,
+			0x01,       // model: Aranet2
+			0xc5, 0x01, // H: 45.3%
+			0xff, 0xff, // P: absent
+			0xf3, 0xfd, // T: -5.25°C
+			0xff, 0xff, // CO2: absent
+			0x5f, 0x01,
+		}
+	)
+	for _, tc := range []struct {
+		name string
+		raw  []byte
+		want Data
+		err  error
+	}{
+		{name: "v0", raw: v0, want: testSample()},
+		{name: "v1", raw: v1, want: testSample()},
+		{name: "v2", raw: v2, want: testSample()},
+		{name: "v2-aranet2", raw: v2Aranet2, want: testSampleAranet2()},
+		{name: "v1-bad-version", raw: append([]byte{2}, v0...), err: errors.New("aranet4: unknown binary encoding version 2")},
+		{name: "v2-bad-version", raw: append([]byte{3}, v2[1:]...), err: errors.New("aranet4: unknown binary encoding version 3")},
+		{name: "short", raw: v0[:16], err: io.ErrShortBuffer},
+		{name: "empty", raw: nil, err: io.ErrShortBuffer},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got Data
+			err := got.Unmarshal(tc.raw)
+			switch {
+			case tc.err == nil && err != nil:
+				t.Fatalf("could not unmarshal data: %+v", err)
+			case tc.err != nil && (err == nil || err.Error() != tc.err.Error()):
+				t.Fatalf("invalid error: got=%v, want=%v", err, tc.err)
+			}
+			if got != tc.want {
+				t.Fatalf("invalid data:\ngot= %+v\nwant=%+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func FuzzDataMarshal(f *testing.F) {
+	for _, v := range []Data{testSample(), testSampleAranet2()} {
+		p := make([]byte, v.BinarySize())
+		if err := v.Marshal(p); err != nil {
+			f.Fatalf("could not marshal seed: %+v", err)
+		}
+		f.Add(p)
+	}
+	f.Add(make([]byte, dataSizeV0))
+
+	f.Fuzz(func(t *testing.T, p []byte) {
+		var v Data
+		if err := v.Unmarshal(p); err != nil {
+			return
+		}
+		// decoded samples must re-encode, and decode back to themselves.
+		buf := make([]byte, v.BinarySize())
+		if err := v.Marshal(buf); err != nil {
+			t.Fatalf("could not marshal %+v: %+v", v, err)
+		}
+		var got Data
+		if err := got.Unmarshal(buf); err != nil {
+			t.Fatalf("could not unmarshal %x: %+v", buf, err)
+		}
+		if !sameData(got, v) {
+			t.Fatalf("invalid round-trip:\ngot= %+v\nwant=%+v", got, v)
+		}
+	})
+}
+
+func TestDataMarshalBoundaries(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data Data
+	}{
+		{name: "T-sub-zero", data: Data{T: -0.05}},
+		{name: "T-min-sensor", data: Data{T: -40}},
+		{name: "T-min", data: Data{T: -327.67}},
+		{name: "T-absent", data: Data{T: math.NaN()}},
+		{name: "T-max", data: Data{T: 327.67}},
+		{name: "P-zero", data: Data{P: 0}},
+		{name: "P-max", data: Data{P: 6553.4}},
+		{name: "P-max-sensor", data: Data{P: 1100}},
+		{name: "battery-unknown", data: Data{Battery: -1}},
+		{name: "CO2-max", data: Data{CO2: binNoValue - 1}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			want := tc.data
+			want.Time = time.Unix(0, 0).UTC()
+			want.Quality = QualityFrom(want.CO2)
+			p := make([]byte, want.BinarySize())
+			err := want.Marshal(p)
+			if err != nil {
+				t.Fatalf("could not marshal data: %+v", err)
+			}
+			var got Data
+			err = got.Unmarshal(p)
+			if err != nil {
+				t.Fatalf("could not unmarshal data: %+v", err)
+			}
+			if !sameData(got, want) {
+				t.Fatalf("invalid round-trip:\ngot= %+v\nwant=%+v", got, want)
+			}
+		})
+	}
+}
+
+func TestDataUnmarshalV0Battery(t *testing.T) {
+	// unsigned version 0 encodings stored a -1 battery as 255.
+	p := make([]byte, dataSizeV0)
+	p[15] = 0xff
+	var got Data
+	err := got.Unmarshal(p)
+	if err != nil {
+		t.Fatalf("could not unmarshal data: %+v", err)
+	}
+	if got.Battery != -1 {
+		t.Fatalf("invalid battery: got=%d, want=-1", got.Battery)
+	}
+}
+
+func TestDataMarshalRange(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data Data
+	}{
+		{name: "CO2-sentinel-value", data: Data{CO2: binNoValue}},
+		{name: "CO2-negative", data: Data{CO2: -2}},
+		{name: "P-sentinel-value", data: Data{P: 6553.5}},
+		{name: "P-negative", data: Data{P: -2}},
+		{name: "T-sentinel-value", data: Data{T: -327.68}},
+		{name: "T-too-low", data: Data{T: -327.69}},
+		{name: "T-too-high", data: Data{T: 327.68}},
+		{name: "battery-too-low", data: Data{Battery: -129}},
+		{name: "model", data: Data{Model: 200}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := make([]byte, tc.data.BinarySize())
+			err := tc.data.Marshal(p)
+			if err == nil {
+				t.Fatalf("expected an out of range error")
+			}
+		})
+	}
+}
+
+func TestModelFrom(t *testing.T) {
+	for _, tc := range []struct {
+		number string
+		want   Model
+	}{
+		{"Aranet4 HOME", Aranet4},
+		{"Aranet2 HOME", Aranet2},
+		{"Aranet Radiation", UnknownModel},
+		{"", UnknownModel},
+	} {
+		got := ModelFrom(tc.number)
+		if got != tc.want {
+			t.Errorf("invalid model for %q: got=%v, want=%v", tc.number, got, tc.want)
+		}
+	}
+}
+
+func TestModelText(t *testing.T) {
+	for _, want := range []Model{Aranet4, Aranet2, UnknownModel} {
+		p, err := want.MarshalText()
+		if err != nil {
+			t.Fatalf("could not marshal %v: %+v", want, err)
+		}
+		var got Model
+		err = got.UnmarshalText(p)
+		if err != nil {
+			t.Fatalf("could not unmarshal %q: %+v", p, err)
+		}
+		if got != want {
+			t.Fatalf("invalid round-trip: got=%v, want=%v", got, want)
+		}
+	}
+}
+
+func TestInferInterval(t *testing.T) {
+	// at returns samples at the given offsets, in seconds.
+	at := func(secs ...int) []Data {
+		t0 := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+		vs := make([]Data, len(secs))
+		for i, s := range secs {
+			vs[i].Time = t0.Add(time.Duration(s) * time.Second)
+		}
+		return vs
+	}
+	for _, tc := range []struct {
+		name string
+		vs   []Data
+		want time.Duration
+	}{
+		{name: "empty", vs: nil, want: 0},
+		{name: "single", vs: at(0), want: 0},
+		{name: "duplicates", vs: at(0, 1, 2), want: 0},
+		{name: "regular", vs: at(0, 60, 120, 180), want: time.Minute},
+		{name: "jitter", vs: at(0, 299, 601, 900, 1199), want: 5 * time.Minute},
+		{name: "gap", vs: at(0, 60, 120, 3600, 3660), want: time.Minute},
+		{name: "duplicate-samples", vs: at(0, 0, 120, 120, 240), want: 2 * time.Minute},
+		{name: "tie", vs: at(0, 300, 360), want: time.Minute},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := InferInterval(tc.vs)
+			if got != tc.want {
+				t.Fatalf("invalid interval: got=%v, want=%v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestTemperatureUnits(t *testing.T) {
+	for _, tc := range []struct {
+		c, f, k float64
+	}{
+		{c: 0, f: 32, k: 273.15},
+		{c: 25, f: 77, k: 298.15},
+		{c: -40, f: -40, k: 233.15},
+		{c: 100, f: 212, k: 373.15},
+	} {
+		v := Data{T: tc.c}
+		if got := v.TemperatureF(); math.Abs(got-tc.f) > 1e-9 {
+			t.Errorf("invalid temperature for %g°C: got=%g°F, want=%g°F", tc.c, got, tc.f)
+		}
+		if got := v.TemperatureK(); math.Abs(got-tc.k) > 1e-9 {
+			t.Errorf("invalid temperature for %g°C: got=%gK, want=%gK", tc.c, got, tc.k)
+		}
+	}
+}
+
+func TestDataStringGolden(t *testing.T) {
+	now := testSample().Time.Add(90 * time.Second)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	var o strings.Builder
+	for _, v := range []Data{testSample(), testSampleAranet2(), testSampleGap()} {
+		fmt.Fprintf(&o, "%s\n%s\n", v.String(), v.Line())
+	}
+	assertGolden(t, "data.txt", []byte(o.String()))
+}
+
+func TestStats(t *testing.T) {
+	sample := func(co2 int, temp, h, p float64) Data {
+		return Data{CO2: co2, T: temp, H: h, P: p}
+	}
+	for _, tc := range []struct {
+		name          string
+		vs            Samples
+		co2, tt, h, p Stats
+	}{
+		{name: "empty"},
+		{
+			name: "normal",
+			vs: Samples{
+				sample(800, 20, 40, 1000),
+				sample(400, 22, 50, 1010),
+				sample(600, 24, 30, 1020),
+			},
+			co2: Stats{Min: 400, Max: 800, Mean: 600, N: 3},
+			tt:  Stats{Min: 20, Max: 24, Mean: 22, N: 3},
+			h:   Stats{Min: 30, Max: 50, Mean: 40, N: 3},
+			p:   Stats{Min: 1000, Max: 1020, Mean: 1010, N: 3},
+		},
+		{
+			name: "absent",
+			vs: Samples{
+				sample(800, 20, 40, 1000),
+				sample(-1, math.NaN(), 50, -1),
+				sample(600, 24, 30, 1020),
+			},
+			co2: Stats{Min: 600, Max: 800, Mean: 700, N: 2},
+			tt:  Stats{Min: 20, Max: 24, Mean: 22, N: 2},
+			h:   Stats{Min: 30, Max: 50, Mean: 40, N: 3},
+			p:   Stats{Min: 1000, Max: 1020, Mean: 1010, N: 2},
+		},
+		{
+			name: "aranet2",
+			vs:   Samples{testSampleAranet2(), testSampleAranet2()},
+			tt:   Stats{Min: -5.25, Max: -5.25, Mean: -5.25, N: 2},
+			h:    Stats{Min: 45.3, Max: 45.3, Mean: 45.3, N: 2},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, st := range []struct {
+				name      string
+				got, want Stats
+			}{
+				{"CO2", tc.vs.CO2Stats(), tc.co2},
+				{"T", tc.vs.TStats(), tc.tt},
+				{"H", tc.vs.HStats(), tc.h},
+				{"P", tc.vs.PStats(), tc.p},
+			} {
+				if st.got != st.want {
+					t.Errorf("invalid %s stats: got=%+v, want=%+v", st.name, st.got, st.want)
+				}
+			}
+		})
+	}
+}
@@ -5,11 +5,102 @@
 package aranet4
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/rigado/ble"
 )
 
+// connect scans for the device at addr and connects to it, using the
+// BLE adapter configured in cfg or the default one.
+func connect(ctx context.Context, addr string, cfg config) (ble.Client, error) {
+	var (
+		scan = func(ctx context.Context, h ble.AdvHandler) error {
+			return ble.Scan(ctx, false, h, nil)
+		}
+		dialAddr = ble.Dial
+	)
+	if cfg.device != nil {
+		scan = func(ctx context.Context, h ble.AdvHandler) error {
+			return cfg.device.Scan(ctx, false, h)
+		}
+		dialAddr = cfg.device.Dial
+	}
+
+	match := func(a ble.Advertisement) bool {
+		if !strings.EqualFold(a.Addr().String(), addr) {
+			return false
+		}
+		random := a.AddrType()&1 == 1 // random and resolvable random addresses
+		switch cfg.addrType {
+		case AddressPublic:
+			return !random
+		case AddressRandom:
+			return random
+		default:
+			return true
+		}
+	}
+
+	sctx, cancel := context.WithTimeout(ctx, cfg.scanTimeout)
+	defer cancel()
+	sctx = ble.WithSigHandler(sctx, cancel)
+
+	found := make(chan ble.Addr, 1)
+	err := scan(sctx, func(a ble.Advertisement) {
+		if !match(a) {
+			return
+		}
+		select {
+		case found <- a.Addr():
+			cancel()
+		default:
+		}
+	})
+
+	var a ble.Addr
+	select {
+	case a = <-found:
+	default:
+		switch {
+		case ctx.Err() != nil:
+			return nil, ctx.Err()
+		case err == nil, errors.Is(err, context.DeadlineExceeded):
+			return nil, fmt.Errorf("%w: no advertisement within %v", ErrDeviceNotFound, cfg.scanTimeout)
+		default:
+			return nil, fmt.Errorf("can't scan: %w", err)
+		}
+	}
+
+	dctx, cancel := context.WithTimeout(ctx, cfg.connectTimeout)
+	defer cancel()
+
+	cln, err := dialAddr(ble.WithSigHandler(dctx, cancel), a)
+	if err != nil {
+		if ctx.Err() == nil && dctx.Err() != nil {
+			return nil, fmt.Errorf("%w: %w", ErrConnectTimeout, err)
+		}
+		return nil, fmt.Errorf("can't dial: %w", err)
+	}
+	return cln, nil
+}
+
+// client is the subset of ble.Client used by Device.
+// It allows Device to be exercised with a fake BLE stack.
+type client interface {
+	Name() string
+	ReadCharacteristic(c *ble.Characteristic) ([]byte, error)
+	WriteCharacteristic(c *ble.Characteristic, value []byte, noRsp bool) error
+	Subscribe(c *ble.Characteristic, ind bool, h ble.NotificationHandler) error
+	Unsubscribe(c *ble.Characteristic, ind bool) error
+	CancelConnection() error
+	Disconnected() <-chan struct{}
+}
+
+var _ client = (ble.Client)(nil)
+
 func (dev *Device) devCharByUUID(id string) (*ble.Characteristic, error) {
 	uuid, err := ble.Parse(id)
 	if err != nil {
@@ -17,7 +108,7 @@ func (dev *Device) devCharByUUID(id string) (*ble.Characteristic, error) {
 	}
 	char := dev.profile.FindCharacteristic(&ble.Characteristic{UUID: uuid})
 	if char == nil {
-		return nil, fmt.Errorf("characteristic %q not found", id)
+		return nil, fmt.Errorf("characteristic %q: %w", id, errNoChar)
 	}
 	return char, nil
 }
@@ -0,0 +1,108 @@
+// Copyright ©2023 The aranet4 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package aranet4
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rigado/ble"
+)
+
+func TestConnect(t *testing.T) {
+	const addr = "aa:bb:cc:dd:ee:ff"
+	f := newFakeClient()
+	cln, err := connect(context.Background(), "AA:BB:CC:DD:EE:FF", newConfig([]Option{
+		WithDevice(dialFake(addr, f)),
+	}))
+	if err != nil {
+		t.Fatalf("could not connect: %+v", err)
+	}
+	if cln != f {
+		t.Fatalf("invalid client: got=%v, want the fake client", cln)
+	}
+}
+
+func TestConnectDeviceNotFound(t *testing.T) {
+	adapter := dialFake("11:22:33:44:55:66", newFakeClient())
+	_, err := connect(context.Background(), "aa:bb:cc:dd:ee:ff", newConfig([]Option{
+		WithDevice(adapter),
+		WithScanTimeout(10 * time.Millisecond),
+	}))
+	if !errors.Is(err, ErrDeviceNotFound) {
+		t.Fatalf("invalid error: got=%+v, want=%v", err, ErrDeviceNotFound)
+	}
+}
+
+func TestConnectTimeout(t *testing.T) {
+	const addr = "aa:bb:cc:dd:ee:ff"
+	adapter := &fakeAdapter{
+		advs: []fakeAdv{{addr: addr}},
+		dial: func(ctx context.Context, _ ble.Addr) (ble.Client, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+	_, err := connect(context.Background(), addr, newConfig([]Option{
+		WithDevice(adapter),
+		WithConnectTimeout(10 * time.Millisecond),
+	}))
+	if !errors.Is(err, ErrConnectTimeout) {
+		t.Fatalf("invalid error: got=%+v, want=%v", err, ErrConnectTimeout)
+	}
+}
+
+func TestConnectCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := connect(ctx, "aa:bb:cc:dd:ee:ff", newConfig([]Option{
+		WithDevice(dialFake("11:22:33:44:55:66", newFakeClient())),
+	}))
+	if !errors.Is(err, context.Canceled) || errors.Is(err, ErrDeviceNotFound) {
+		t.Fatalf("invalid error: got=%+v, want=%v", err, context.Canceled)
+	}
+}
+
+func TestConnectAddressType(t *testing.T) {
+	const (
+		addr          = "aa:bb:cc:dd:ee:ff"
+		public        = 0x00
+		random        = 0x01
+		randomPrivate = 0x03 // resolvable private address
+	)
+	for _, tc := range []struct {
+		name  string
+		opt   AddressType
+		typ   uint8
+		found bool
+	}{
+		{name: "any-public", opt: AddressAny, typ: public, found: true},
+		{name: "any-random", opt: AddressAny, typ: random, found: true},
+		{name: "public-public", opt: AddressPublic, typ: public, found: true},
+		{name: "public-random", opt: AddressPublic, typ: random, found: false},
+		{name: "random-public", opt: AddressRandom, typ: public, found: false},
+		{name: "random-random", opt: AddressRandom, typ: random, found: true},
+		{name: "random-resolvable", opt: AddressRandom, typ: randomPrivate, found: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newFakeClient()
+			adapter := dialFake(addr, f)
+			adapter.advs[0].typ = tc.typ
+			_, err := connect(context.Background(), addr, newConfig([]Option{
+				WithDevice(adapter),
+				WithAddressType(tc.opt),
+				WithScanTimeout(10 * time.Millisecond),
+			}))
+			switch {
+			case tc.found && err != nil:
+				t.Fatalf("could not connect: %+v", err)
+			case !tc.found && !errors.Is(err, ErrDeviceNotFound):
+				t.Fatalf("invalid error: got=%+v, want=%v", err, ErrDeviceNotFound)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright ©2023 The aranet4 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/knyar/aranet4-ble"
+)
+
+// printer prints readings in one of the output formats of aranet4-ls:
+//   - text:  the multi-line format of aranet4.Data.String,
+//   - table: aligned columns with units, under a header line,
+//   - json:  one JSON object per line, see aranet4.Data.MarshalJSON,
+//   - csv:   CSV records under a header line, see aranet4.WriteCSV.
+type printer struct {
+	w      io.Writer
+	format string
+	n      int // number of printed readings
+
+	enc *json.Encoder
+	csv *csv.Writer
+}
+
+func newPrinter(w io.Writer, format string) (*printer, error) {
+	p := &printer{w: w, format: format}
+	switch format {
+	case "text", "table":
+	case "json":
+		p.enc = json.NewEncoder(w)
+	case "csv":
+		p.csv = csv.NewWriter(w)
+	default:
+		return nil, fmt.Errorf("unknown format %q (want text, table, json or csv)", format)
+	}
+	return p, nil
+}
+
+// Print prints a single reading.
+func (p *printer) Print(data aranet4.Data) error {
+	defer func() { p.n++ }()
+
+	switch p.format {
+	case "json":
+		return p.enc.Encode(data)
+	case "csv":
+		return p.printCSV(data)
+	case "table":
+		var err error
+		if p.n == 0 {
+			_, err = fmt.Fprintf(p.w, "%-20s %8s %8s %7s %9s %8s %-7s\n",
+				"TIME", "CO2[ppm]", "T[°C]", "H[%]", "P[hPa]", "BATT[%]", "QUALITY",
+			)
+			if err != nil {
+				return err
+			}
+		}
+		// absent values, e.g. for Aranet2 devices, are shown as n/a.
+		co2, t, pr, q := "n/a", "n/a", "n/a", "n/a"
+		if data.CO2 != -1 {
+			co2 = strconv.Itoa(data.CO2)
+			q = data.Quality.String()
+		}
+		if !math.IsNaN(data.T) {
+			t = strconv.FormatFloat(data.T, 'f', 2, 64)
+		}
+		if data.P != -1 {
+			pr = strconv.FormatFloat(data.P, 'f', 1, 64)
+		}
+		_, err = fmt.Fprintf(p.w, "%-20s %8s %8s %7.1f %9s %8d %-7s\n",
+			data.Time.UTC().Format(time.DateTime), co2,
+			t, data.H, pr, data.Battery, q,
+		)
+		return err
+	default:
+		if p.n > 0 {
+			_, err := fmt.Fprintln(p.w)
+			if err != nil {
+				return err
+			}
+		}
+		_, err := fmt.Fprintf(p.w, "%v", data)
+		return err
+	}
+}
+
+// printCSV prints data as a CSV record, preceded by a header line for
+// the first reading.
+// Records are flushed one at a time so that readings show up as they
+// are received.
+func (p *printer) printCSV(data aranet4.Data) error {
+	if p.n == 0 {
+		err := p.csv.Write(aranet4.CSVHeader())
+		if err != nil {
+			return err
+		}
+	}
+	rec, err := data.AppendCSV(nil)
+	if err != nil {
+		return err
+	}
+	err = p.csv.Write(rec)
+	if err != nil {
+		return err
+	}
+	p.csv.Flush()
+	return p.csv.Error()
+}
@@ -9,6 +9,9 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
+	"os"
+	"os/signal"
 	"time"
 
 	"github.com/knyar/aranet4-ble"
@@ -24,9 +27,31 @@ func main() {
 		hciSkt  = flag.Int("device", -1, "bluetooth device hci index")
 		addr    = flag.String("addr", "F5:6C:BE:D5:61:47", "MAC address of Aranet4")
 		verbose = flag.Bool("v", false, "enable verbose mode")
+		scan    = flag.Bool("scan", false, "scan for nearby Aranet4 devices and exit")
+		watch   = flag.Bool("watch", false, "print a new reading every measurement interval until interrupted")
+		format  = flag.String("format", "", "output format (text, table, json or csv); defaults to text, or table with -watch")
+		jsonOut = flag.Bool("json", false, "print readings as JSON (shorthand for -format=json)")
+		lvl     slog.Level
 	)
+	flag.TextVar(&lvl, "log-level", slog.LevelInfo, "log level (debug, info, warn, error)")
 
 	flag.Parse()
+	slog.SetLogLoggerLevel(lvl)
+
+	switch {
+	case *jsonOut && *format != "" && *format != "json":
+		log.Fatalf("-json conflicts with -format=%s", *format)
+	case *jsonOut:
+		*format = "json"
+	case *format == "" && *watch:
+		*format = "table"
+	case *format == "":
+		*format = "text"
+	}
+	out, err := newPrinter(os.Stdout, *format)
+	if err != nil {
+		log.Fatalf("invalid output format: %+v", err)
+	}
 
 	d, err := linux.NewDevice(
 		ble.OptTransportHCISocket(*hciSkt),
@@ -37,7 +62,19 @@ func main() {
 	}
 	ble.SetDefaultDevice(d)
 
-	dev, err := aranet4.New(context.Background(), *addr)
+	if *scan {
+		const scanDuration = 10 * time.Second
+		advs, err := aranet4.Scan(context.Background(), scanDuration)
+		if err != nil {
+			log.Fatalf("could not scan for devices: %+v", err)
+		}
+		for _, adv := range advs {
+			fmt.Printf("%s\t%q\t%d dBm\n", adv.Addr, adv.Name, adv.RSSI)
+		}
+		return
+	}
+
+	dev, err := aranet4.New(context.Background(), *addr, aranet4.WithDevice(d))
 	if err != nil {
 		log.Fatalf("could not create aranet4 client: %+v", err)
 	}
@@ -53,14 +90,67 @@ func main() {
 		log.Printf("vers: %q", vers)
 	}
 
-	data, err := dev.Read()
-	if err != nil {
-		log.Fatalf("could not run client: %+v", err)
+	if *watch {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		err = watchDevice(ctx, out, dev)
+		if err != nil {
+			log.Fatalf("could not watch device: %+v", err)
+		}
+	} else {
+		data, err := dev.Read()
+		if err != nil {
+			log.Fatalf("could not run client: %+v", err)
+		}
+		err = out.Print(data)
+		if err != nil {
+			log.Fatalf("could not print data: %+v", err)
+		}
 	}
-	fmt.Printf("%v", data)
 
 	err = dev.Close()
 	if err != nil {
 		log.Fatalf("could not close client: %+v", err)
 	}
 }
+
+// watchDevice prints a new reading of dev with out every measurement
+// interval, until ctx is done.
+func watchDevice(ctx context.Context, out *printer, dev *aranet4.Device) error {
+	// slack leaves the device some time to publish a new sample.
+	const slack = 5 * time.Second
+
+	interval, err := dev.IntervalContext(ctx)
+	if err != nil {
+		return fmt.Errorf("could not read interval: %w", err)
+	}
+
+	for {
+		data, err := dev.ReadWithRetry(ctx, 3, time.Second)
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case err != nil:
+			return err
+		}
+
+		err = out.Print(data)
+		if err != nil {
+			return fmt.Errorf("could not print data: %w", err)
+		}
+
+		if data.Interval > 0 {
+			interval = data.Interval
+		}
+		next := data.Time.Add(interval + slack)
+		if !next.After(time.Now()) {
+			next = time.Now().Add(interval)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Until(next)):
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright ©2023 The aranet4 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package aranet4
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"time"
+)
+
+var csvHeader = []string{
+	"time", "co2", "temperature", "humidity", "pressure",
+	"battery", "quality", "interval", "model",
+}
+
+// csvHeaderV0 is the header of CSV files written before the model column
+// was added.
+var csvHeaderV0 = csvHeader[:8]
+
+// WriteCSV writes vs to w as CSV, with a header line.
+// Columns are: time (RFC3339), CO2 (ppm), temperature (°C), humidity (%),
+// pressure (hPa), battery (%), quality (see Quality.MarshalText),
+// interval and model.
+func WriteCSV(w io.Writer, vs []Data) error {
+	cw := csv.NewWriter(w)
+	err := cw.Write(csvHeader)
+	if err != nil {
+		return fmt.Errorf("aranet4: could not write CSV header: %w", err)
+	}
+
+	rec := make([]string, 0, len(csvHeader))
+	for i, v := range vs {
+		rec, err = v.AppendCSV(rec[:0])
+		if err != nil {
+			return fmt.Errorf("aranet4: could not encode CSV record %d: %w", i, err)
+		}
+		err = cw.Write(rec)
+		if err != nil {
+			return fmt.Errorf("aranet4: could not write CSV record %d: %w", i, err)
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// CSVHeader returns the header line written by WriteCSV.
+// It allows writing samples as CSV one at a time, together with
+// Data.AppendCSV.
+func CSVHeader() []string {
+	return slices.Clone(csvHeader)
+}
+
+// AppendCSV appends the fields of the CSV record of the sample, as
+// written by WriteCSV, to rec and returns the extended slice.
+// Fields are in the order of CSVHeader.
+func (data Data) AppendCSV(rec []string) ([]string, error) {
+	q, err := data.Quality.MarshalText()
+	if err != nil {
+		return rec, fmt.Errorf("could not encode quality: %w", err)
+	}
+	return append(rec,
+		data.Time.UTC().Format(time.RFC3339Nano),
+		strconv.Itoa(data.CO2),
+		strconv.FormatFloat(data.T, 'g', -1, 64),
+		strconv.FormatFloat(data.H, 'g', -1, 64),
+		strconv.FormatFloat(data.P, 'g', -1, 64),
+		strconv.Itoa(data.Battery),
+		string(q),
+		data.Interval.String(),
+		data.Model.String(),
+	), nil
+}
+
+// ReadCSV reads samples written by WriteCSV from r.
+// ReadCSV also accepts files written before the model column was added,
+// whose samples are assumed to come from Aranet4 devices.
+func ReadCSV(r io.Reader) ([]Data, error) {
+	cr := csv.NewReader(r)
+	cr.ReuseRecord = true
+
+	hdr, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("aranet4: could not read CSV header: %w", err)
+	}
+	if !slices.Equal(hdr, csvHeader) && !slices.Equal(hdr, csvHeaderV0) {
+		return nil, fmt.Errorf("aranet4: invalid CSV header %q", hdr)
+	}
+	cr.FieldsPerRecord = len(hdr)
+
+	var vs []Data
+	for {
+		rec, err := cr.Read()
+		if err != nil {
+			if err == io.EOF {
+				return vs, nil
+			}
+			return nil, fmt.Errorf("aranet4: could not read CSV record: %w", err)
+		}
+
+		var v Data
+		err = v.unmarshalCSV(rec)
+		if err != nil {
+			line, _ := cr.FieldPos(0)
+			return nil, fmt.Errorf("aranet4: could not decode CSV record (line %d): %w", line, err)
+		}
+		vs = append(vs, v)
+	}
+}
+
+func (data *Data) unmarshalCSV(rec []string) error {
+	var err error
+	data.Time, err = time.Parse(time.RFC3339Nano, rec[0])
+	if err != nil {
+		return fmt.Errorf("could not parse time: %w", err)
+	}
+	data.Time = data.Time.UTC()
+
+	data.CO2, err = strconv.Atoi(rec[1])
+	if err != nil {
+		return fmt.Errorf("could not parse CO2: %w", err)
+	}
+	data.T, err = strconv.ParseFloat(rec[2], 64)
+	if err != nil {
+		return fmt.Errorf("could not parse temperature: %w", err)
+	}
+	data.H, err = strconv.ParseFloat(rec[3], 64)
+	if err != nil {
+		return fmt.Errorf("could not parse humidity: %w", err)
+	}
+	data.P, err = strconv.ParseFloat(rec[4], 64)
+	if err != nil {
+		return fmt.Errorf("could not parse pressure: %w", err)
+	}
+	data.Battery, err = strconv.Atoi(rec[5])
+	if err != nil {
+		return fmt.Errorf("could not parse battery: %w", err)
+	}
+	err = data.Quality.UnmarshalText([]byte(rec[6]))
+	if err != nil {
+		return fmt.Errorf("could not parse quality: %w", err)
+	}
+	data.Interval, err = time.ParseDuration(rec[7])
+	if err != nil {
+		return fmt.Errorf("could not parse interval: %w", err)
+	}
+	data.Model = Aranet4
+	if len(rec) > 8 {
+		err = data.Model.UnmarshalText([]byte(rec[8]))
+		if err != nil {
+			return fmt.Errorf("could not parse model: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+// Copyright ©2023 The aranet4 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package aranet4
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCSVRoundTrip(t *testing.T) {
+	want := []Data{testSample(), testSampleAranet2()}
+	var buf bytes.Buffer
+	err := WriteCSV(&buf, want)
+	if err != nil {
+		t.Fatalf("could not write CSV: %+v", err)
+	}
+
+	const out = `time,co2,temperature,humidity,pressure,battery,quality,interval,model
+2023-01-02T03:04:05Z,812,21.35,41,1013.2,87,green,5m0s,aranet4
+2023-01-02T03:04:05Z,-1,-5.25,45.3,-1,95,0,1m0s,aranet2
+`
+	if got := buf.String(); got != out {
+		t.Fatalf("invalid CSV:\ngot:\n%s\nwant:\n%s", got, out)
+	}
+
+	got, err := ReadCSV(&buf)
+	if err != nil {
+		t.Fatalf("could not read CSV: %+v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid round-trip:\ngot= %+v\nwant=%+v", got, want)
+	}
+}
+
+func TestReadCSVLegacy(t *testing.T) {
+	const in = `time,co2,temperature,humidity,pressure,battery,quality,interval
+2023-01-02T03:04:05Z,812,21.35,41,1013.2,87,1,5m0s
+`
+	got, err := ReadCSV(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("could not read CSV: %+v", err)
+	}
+	want := []Data{testSample()}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid data:\ngot= %+v\nwant=%+v", got, want)
+	}
+}
+
+func TestReadCSVInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		csv  string
+	}{
+		{name: "empty", csv: ""},
+		{name: "header", csv: "time,co2\n"},
+		{name: "short-record", csv: "time,co2,temperature,humidity,pressure,battery,quality,interval,model\n2023-01-02T03:04:05Z,812\n"},
+		{name: "quality", csv: "time,co2,temperature,humidity,pressure,battery,quality,interval,model\n2023-01-02T03:04:05Z,812,21.35,41,1013.2,87,blue,5m0s,aranet4\n"},
+		{name: "model", csv: "time,co2,temperature,humidity,pressure,battery,quality,interval,model\n2023-01-02T03:04:05Z,812,21.35,41,1013.2,87,green,5m0s,aranet9\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ReadCSV(strings.NewReader(tc.csv))
+			if err == nil {
+				t.Fatalf("expected an error")
+			}
+		})
+	}
+}
+
+func TestAppendCSV(t *testing.T) {
+	vs := []Data{testSample(), testSampleAranet2()}
+	var want bytes.Buffer
+	err := WriteCSV(&want, vs)
+	if err != nil {
+		t.Fatalf("could not write CSV: %+v", err)
+	}
+
+	var got bytes.Buffer
+	cw := csv.NewWriter(&got)
+	err = cw.Write(CSVHeader())
+	if err != nil {
+		t.Fatalf("could not write CSV header: %+v", err)
+	}
+	for _, v := range vs {
+		rec, err := v.AppendCSV(nil)
+		if err != nil {
+			t.Fatalf("could not encode CSV record: %+v", err)
+		}
+		err = cw.Write(rec)
+		if err != nil {
+			t.Fatalf("could not write CSV record: %+v", err)
+		}
+	}
+	cw.Flush()
+
+	if got.String() != want.String() {
+		t.Fatalf("CSV records differ from WriteCSV:\ngot:\n%s\nwant:\n%s", &got, &want)
+	}
+}
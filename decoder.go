@@ -8,6 +8,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"math"
 	"time"
 )
 
@@ -58,6 +59,69 @@ func (dec *decoder) readField(id byte, v *Data) error {
 	}
 }
 
+// clearField marks the field id of v as absent.
+// Humidity has no absent value and is left untouched.
+func clearField(id byte, v *Data) {
+	switch id {
+	case paramT:
+		v.T = math.NaN()
+	case paramP:
+		v.P = -1
+	case paramCO2:
+		v.CO2 = -1
+	}
+}
+
+// readData decodes a current-readings payload, as exposed by the
+// uuidReadAll characteristic and embedded in advertisements.
+func (dec *decoder) readData(v *Data) error {
+	dec.readCO2(&v.CO2)
+	dec.readT(&v.T)
+	dec.readP(&v.P)
+	dec.readH(&v.H)
+	dec.readBattery(&v.Battery)
+	dec.readQuality(&v.Quality)
+	dec.readInterval(&v.Interval)
+	dec.readTime(&v.Time)
+	return dec.err
+}
+
+// readDataAranet2 decodes the current-readings payload of an Aranet2,
+// exposed by the uuidReadSampleAranet2 characteristic:
+//
+//	[0:2]   flags
+//	[2:4]   interval, in seconds
+//	[4:6]   seconds since the last measurement
+//	[6]     battery, in %
+//	[7:9]   temperature, in 1/20 °C
+//	[9:11]  humidity, in 1/10 %
+//	[11]    status
+//
+// Aranet2 devices measure neither CO2 nor pressure: these fields are
+// set to -1, and the quality is left to zero.
+func (dec *decoder) readDataAranet2(v *Data) error {
+	v.CO2 = -1
+	v.P = -1
+
+	var skip uint16
+	dec.readUint16(&skip)
+	dec.readInterval(&v.Interval)
+	dec.readTime(&v.Time)
+	dec.readBattery(&v.Battery)
+	dec.readT(&v.T)
+	dec.readH10(&v.H)
+	return dec.err
+}
+
+func (dec *decoder) readUint16(v *uint16) error {
+	err := dec.load2()
+	if err != nil {
+		return err
+	}
+	*v = binary.LittleEndian.Uint16(dec.buf)
+	return nil
+}
+
 func (dec *decoder) readCO2(v *int) error {
 	err := dec.load2()
 	if err != nil {
@@ -120,6 +184,17 @@ func (dec *decoder) readH(v *float64) error {
 	return nil
 }
 
+// readH10 reads a humidity value with a 0.1% resolution.
+func (dec *decoder) readH10(v *float64) error {
+	err := dec.load2()
+	if err != nil {
+		return err
+	}
+
+	*v = float64(binary.LittleEndian.Uint16(dec.buf)) / 10
+	return nil
+}
+
 func (dec *decoder) readBattery(v *int) error {
 	err := dec.load1()
 	if err != nil {
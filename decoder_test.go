@@ -0,0 +1,107 @@
+// Copyright ©2023 The aranet4 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package aranet4
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestDecodeField(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		id   byte
+		raw  []byte
+		want Data
+		err  error
+	}{
+		{name: "T", id: paramT, raw: []byte{0xad, 0x01}, want: Data{T: 21.45}},
+		{name: "T-no-data", id: paramT, raw: []byte{0x00, 0x40}, err: ErrNoData},
+		{name: "T-negative", id: paramT, raw: []byte{0x01, 0x80 + 1}, want: Data{T: 0}},
+		{name: "H", id: paramH, raw: []byte{42}, want: Data{H: 42}},
+		{name: "P", id: paramP, raw: []byte{0x94, 0x27}, want: Data{P: 1013.2}},
+		{name: "P-no-data", id: paramP, raw: []byte{0x00, 0x80}, err: ErrNoData},
+		{name: "CO2", id: paramCO2, raw: []byte{0x2c, 0x03}, want: Data{CO2: 812}},
+		{name: "CO2-no-data", id: paramCO2, raw: []byte{0x00, 0x80}, err: ErrNoData},
+		{name: "short", id: paramCO2, raw: []byte{0x2c}, err: io.ErrUnexpectedEOF},
+		{name: "empty", id: paramT, raw: nil, err: io.EOF},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got Data
+			err := newDecoder(bytes.NewReader(tc.raw)).readField(tc.id, &got)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("invalid error: got=%v, want=%v", err, tc.err)
+			}
+			if got != tc.want {
+				t.Fatalf("invalid value:\ngot= %+v\nwant=%+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDecodeFieldUnknown(t *testing.T) {
+	var v Data
+	err := newDecoder(bytes.NewReader([]byte{1, 2})).readField(42, &v)
+	if err == nil {
+		t.Fatalf("expected an error for an unknown parameter")
+	}
+}
+
+func TestDecodeData(t *testing.T) {
+	raw := []byte{
+		0x2c, 0x03, // CO2: 812 ppm
+		0xad, 0x01, // T: 21.45°C
+		0x94, 0x27, // P: 1013.2 hPa
+		0x2a,       // H: 42%
+		0x57,       // battery: 87%
+		0x01,       // quality: green
+		0x2c, 0x01, // interval: 300s
+		0x0a, 0x00, // 10s ago
+	}
+	var got Data
+	err := newDecoder(bytes.NewReader(raw)).readData(&got)
+	if err != nil {
+		t.Fatalf("could not decode data: %+v", err)
+	}
+	assertNear(t, "time-stamp", got.Time, time.Now().Add(-10*time.Second))
+	got.Time = time.Time{}
+
+	want := Data{CO2: 812, T: 21.45, P: 1013.2, H: 42, Battery: 87, Quality: 1, Interval: 5 * time.Minute}
+	if got != want {
+		t.Fatalf("invalid data:\ngot= %+v\nwant=%+v", got, want)
+	}
+
+	err = newDecoder(bytes.NewReader(raw[:len(raw)-1])).readData(&got)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("invalid error for a truncated payload: %v", err)
+	}
+}
+
+func TestDecodeDataAranet2(t *testing.T) {
+	raw := []byte{
+		0x00, 0x00, // flags
+		0x3c, 0x00, // interval: 60s
+		0x05, 0x00, // 5s ago
+		0x5f,       // battery: 95%
+		0xae, 0x01, // T: 21.5°C
+		0xc5, 0x01, // H: 45.3%
+		0x00, // status
+	}
+	var got Data
+	err := newDecoder(bytes.NewReader(raw)).readDataAranet2(&got)
+	if err != nil {
+		t.Fatalf("could not decode data: %+v", err)
+	}
+	assertNear(t, "time-stamp", got.Time, time.Now().Add(-5*time.Second))
+	got.Time = time.Time{}
+
+	want := Data{T: 21.5, H: 45.3, CO2: -1, P: -1, Battery: 95, Interval: time.Minute}
+	if got != want {
+		t.Fatalf("invalid data:\ngot= %+v\nwant=%+v", got, want)
+	}
+}
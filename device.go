@@ -10,8 +10,10 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
-	"log"
-	"strings"
+	"iter"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/rigado/ble"
@@ -20,22 +22,29 @@ import (
 type Device struct {
 	addr    string
 	name    string
-	dev     ble.Client
+	dev     client
 	profile *ble.Profile
+	model   Model
+	cfg     config
+
+	closed atomic.Bool // whether the connection was closed or aborted
+}
+
+func New(ctx context.Context, addr string, opts ...Option) (*Device, error) {
+	return dial(ctx, addr, newConfig(opts))
 }
 
-func New(ctx context.Context, addr string) (*Device, error) {
-	const scanDeadline = 15 * time.Second
-	ctx = ble.WithSigHandler(context.WithTimeout(ctx, scanDeadline))
+// dialDevice connects to a device when reconnecting.
+// It is replaced in tests.
+var dialDevice = dial
 
-	cln, err := ble.Connect(ctx, func(a ble.Advertisement) bool {
-		return strings.EqualFold(a.Addr().String(), addr)
-	})
+func dial(ctx context.Context, addr string, cfg config) (*Device, error) {
+	cln, err := connect(ctx, addr, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("could not connect to device %q: %w", addr, err)
 	}
 
-	log.Printf("connected to device %q", addr)
+	cfg.log().Info("connected to device", "addr", addr)
 
 	name := cln.Name()
 
@@ -44,32 +53,93 @@ func New(ctx context.Context, addr string) (*Device, error) {
 		_ = cln.CancelConnection()
 		return nil, fmt.Errorf("could not discover profile: %w", err)
 	}
-	return &Device{
+
+	dev := &Device{
 		addr:    addr,
 		name:    name,
 		dev:     cln,
 		profile: profile,
-	}, nil
+		cfg:     cfg,
+	}
+
+	model, err := dev.ModelNumberContext(ctx)
+	if err != nil {
+		_ = cln.CancelConnection()
+		return nil, fmt.Errorf("could not get model number: %w", err)
+	}
+	dev.model = ModelFrom(model)
+	if dev.model == UnknownModel {
+		cfg.log().Warn("unknown device model", "addr", addr, "model", model)
+	}
+
+	return dev, nil
 }
 
+// Client returns the underlying BLE client, or nil if the device is not
+// backed by a ble.Client.
 func (dev *Device) Client() ble.Client {
-	return dev.dev
+	cln, _ := dev.dev.(ble.Client)
+	return cln
 }
 
 func (dev *Device) Close() error {
-	if dev.dev == nil {
+	if dev.closed.Swap(true) {
 		return nil
 	}
-	defer func() {
-		<-dev.dev.Disconnected()
-		log.Printf("disconnected from device %q", dev.addr)
-		dev.dev = nil
-	}()
 
 	err := dev.dev.CancelConnection()
 	if err != nil {
 		return fmt.Errorf("could not disconnect: %w", err)
 	}
+	<-dev.dev.Disconnected()
+	dev.cfg.log().Info("disconnected from device", "addr", dev.addr)
+	return nil
+}
+
+// abort cancels the connection to the device, interrupting any in-flight
+// operation, and marks the device as closed.
+func (dev *Device) abort() {
+	if dev.closed.Swap(true) {
+		return
+	}
+	dev.cfg.log().Warn("aborting connection to device", "addr", dev.addr)
+	err := dev.dev.CancelConnection()
+	if err != nil {
+		dev.cfg.log().Warn("could not abort connection", "addr", dev.addr, "err", err)
+	}
+}
+
+// alive reports whether the connection to the device is still open.
+func (dev *Device) alive() bool {
+	if dev.closed.Load() {
+		return false
+	}
+	select {
+	case <-dev.dev.Disconnected():
+		return false
+	default:
+		return true
+	}
+}
+
+// reconnect closes the connection to the device and establishes a new one.
+// If the new connection fails, the device is left closed: its methods
+// return ErrClosed until a later reconnect succeeds.
+func (dev *Device) reconnect(ctx context.Context) error {
+	err := dev.Close()
+	if err != nil {
+		dev.cfg.log().Warn("could not close connection", "addr", dev.addr, "err", err)
+	}
+
+	nd, err := dialDevice(ctx, dev.addr, dev.cfg)
+	if err != nil {
+		return err
+	}
+	dev.name = nd.name
+	dev.dev = nd.dev
+	dev.profile = nd.profile
+	dev.model = nd.model
+	dev.closed.Store(false)
 	return nil
 }
 
@@ -77,56 +147,228 @@ func (dev *Device) Name() string {
 	return dev.name
 }
 
+// Model returns the model of the device, as detected when connecting.
+func (dev *Device) Model() Model {
+	return dev.model
+}
+
 func (dev *Device) Version() (string, error) {
-	c, err := dev.devCharByUUID(uuidCommonReadSWRevision)
+	return dev.VersionContext(context.Background())
+}
+
+// VersionContext is like Version but gives up when ctx is done.
+func (dev *Device) VersionContext(ctx context.Context) (string, error) {
+	return dev.readString(ctx, uuidCommonReadSWRevision)
+}
+
+// SerialNumber returns the serial number of the device.
+func (dev *Device) SerialNumber() (string, error) {
+	return dev.SerialNumberContext(context.Background())
+}
+
+// SerialNumberContext is like SerialNumber but gives up when ctx is done.
+func (dev *Device) SerialNumberContext(ctx context.Context) (string, error) {
+	return dev.readString(ctx, uuidCommonReadSerialNumber)
+}
+
+// HardwareRevision returns the hardware revision of the device.
+func (dev *Device) HardwareRevision() (string, error) {
+	return dev.HardwareRevisionContext(context.Background())
+}
+
+// HardwareRevisionContext is like HardwareRevision but gives up when ctx is done.
+func (dev *Device) HardwareRevisionContext(ctx context.Context) (string, error) {
+	return dev.readString(ctx, uuidCommonReadHWRevision)
+}
+
+// ModelNumber returns the model number of the device.
+func (dev *Device) ModelNumber() (string, error) {
+	return dev.ModelNumberContext(context.Background())
+}
+
+// ModelNumberContext is like ModelNumber but gives up when ctx is done.
+func (dev *Device) ModelNumberContext(ctx context.Context) (string, error) {
+	return dev.readString(ctx, uuidCommonReadModelNumber)
+}
+
+// Manufacturer returns the manufacturer name of the device.
+func (dev *Device) Manufacturer() (string, error) {
+	return dev.ManufacturerContext(context.Background())
+}
+
+// ManufacturerContext is like Manufacturer but gives up when ctx is done.
+func (dev *Device) ManufacturerContext(ctx context.Context) (string, error) {
+	return dev.readString(ctx, uuidCommonReadManufacturerName)
+}
+
+// DeviceInfo holds metadata about an Aranet4 device.
+type DeviceInfo struct {
+	Name     string
+	Version  string
+	Serial   string
+	Interval time.Duration // measurement interval
+	NumData  int           // number of samples stored on the device
+	Since    time.Duration // time since the last measurement
+}
+
+// Info returns the metadata of the device.
+// Fields that could not be read are left empty and their errors are
+// joined in the returned error.
+func (dev *Device) Info() (DeviceInfo, error) {
+	return dev.InfoContext(context.Background())
+}
+
+// InfoContext is like Info but gives up when ctx is done.
+func (dev *Device) InfoContext(ctx context.Context) (DeviceInfo, error) {
+	var (
+		info = DeviceInfo{Name: dev.name}
+		errs []error
+		err  error
+	)
+
+	info.Version, err = dev.VersionContext(ctx)
 	if err != nil {
-		return "", fmt.Errorf("could not get characteristic %q: %w", uuidCommonReadSWRevision, err)
+		errs = append(errs, fmt.Errorf("could not get version: %w", err))
 	}
 
-	raw, err := dev.read(c)
+	info.Serial, err = dev.SerialNumberContext(ctx)
 	if err != nil {
-		return "", fmt.Errorf("could not read device name: %w", err)
+		errs = append(errs, fmt.Errorf("could not get serial number: %w", err))
 	}
-	return string(raw), nil
+
+	info.Interval, err = dev.IntervalContext(ctx)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("could not get sampling: %w", err))
+	}
+
+	info.NumData, err = dev.NumDataContext(ctx)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("could not get total number of samples: %w", err))
+	}
+
+	info.Since, err = dev.SinceContext(ctx)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("could not get last measurement update: %w", err))
+	}
+
+	return info, errors.Join(errs...)
 }
 
 func (dev *Device) Read() (Data, error) {
-	var data Data
+	return dev.ReadContext(context.Background())
+}
+
+// ReadContext is like Read but gives up when ctx is done.
+func (dev *Device) ReadContext(ctx context.Context) (Data, error) {
+	var (
+		data = Data{Model: dev.model}
+		uuid string
+		read func(*decoder, *Data) error
+	)
+	switch dev.model {
+	case Aranet4:
+		uuid = uuidReadAll
+		read = (*decoder).readData
+	case Aranet2:
+		uuid = uuidReadSampleAranet2
+		read = (*decoder).readDataAranet2
+	default:
+		return data, fmt.Errorf("aranet4: reading samples not supported for %v devices: %w", dev.model, errors.ErrUnsupported)
+	}
 
-	c, err := dev.devCharByUUID(uuidReadAll)
+	c, err := dev.devCharByUUID(uuid)
 	if err != nil {
-		return data, fmt.Errorf("could not get characteristic %q: %w", uuidReadAll, err)
+		return data, fmt.Errorf("could not get characteristic %q: %w", uuid, err)
 	}
 
-	raw, err := dev.read(c)
+	raw, err := dev.read(ctx, c)
 	if err != nil {
 		return data, fmt.Errorf("could not get value: %w", err)
 	}
 
 	dec := newDecoder(bytes.NewReader(raw))
-	dec.readCO2(&data.CO2)
-	dec.readT(&data.T)
-	dec.readP(&data.P)
-	dec.readH(&data.H)
-	dec.readBattery(&data.Battery)
-	dec.readQuality(&data.Quality)
-	dec.readInterval(&data.Interval)
-	dec.readTime(&data.Time)
+	err = read(dec, &data)
+	if err != nil {
+		return data, fmt.Errorf("could not decode data sample: %w", err)
+	}
 
-	if dec.err != nil {
-		return data, fmt.Errorf("could not decode data sample: %w", dec.err)
+	if dev.cfg.validate {
+		err = data.Validate()
+		if err != nil {
+			return data, fmt.Errorf("could not validate data sample: %w", err)
+		}
 	}
 
 	return data, nil
 }
 
+// ReadWithRetry is like ReadContext but retries transient failures up to
+// attempts times (at least once), reconnecting to the device between
+// attempts.
+// The delay between attempts starts at backoff and doubles after each
+// failed attempt.
+func (dev *Device) ReadWithRetry(ctx context.Context, attempts int, backoff time.Duration) (Data, error) {
+	var data Data
+	err := retry(ctx, dev.cfg.log().With("addr", dev.addr), attempts, backoff, func(i int) error {
+		if i > 0 {
+			err := dev.reconnect(ctx)
+			if err != nil {
+				return fmt.Errorf("could not reconnect: %w", err)
+			}
+		}
+		var err error
+		data, err = dev.ReadContext(ctx)
+		return err
+	})
+	if err != nil {
+		return data, fmt.Errorf("aranet4: could not read device %q: %w", dev.addr, err)
+	}
+	return data, nil
+}
+
+// Battery returns the battery level of the device, in percent.
+func (dev *Device) Battery() (int, error) {
+	return dev.BatteryContext(context.Background())
+}
+
+// BatteryContext is like Battery but gives up when ctx is done.
+func (dev *Device) BatteryContext(ctx context.Context) (int, error) {
+	c, err := dev.devCharByUUID(uuidCommonReadBattery)
+	if err != nil {
+		return 0, fmt.Errorf("could not get characteristic %q: %w", uuidCommonReadBattery, err)
+	}
+
+	raw, err := dev.read(ctx, c)
+	if err != nil {
+		return 0, fmt.Errorf("could not get value: %w", err)
+	}
+
+	var (
+		v   int
+		dec = newDecoder(bytes.NewReader(raw))
+	)
+	err = dec.readBattery(&v)
+	if err != nil {
+		return 0, fmt.Errorf("could not decode battery value %q: %w", raw, err)
+	}
+	if v > 100 {
+		return 0, fmt.Errorf("invalid battery level %d%%", v)
+	}
+	return v, nil
+}
+
 func (dev *Device) NumData() (int, error) {
+	return dev.NumDataContext(context.Background())
+}
+
+// NumDataContext is like NumData but gives up when ctx is done.
+func (dev *Device) NumDataContext(ctx context.Context) (int, error) {
 	c, err := dev.devCharByUUID(uuidReadTotalReadings)
 	if err != nil {
 		return 0, fmt.Errorf("could not get characteristic %q: %w", uuidReadTotalReadings, err)
 	}
 
-	raw, err := dev.read(c)
+	raw, err := dev.read(ctx, c)
 	if err != nil {
 		return 0, fmt.Errorf("could not get value: %w", err)
 	}
@@ -135,12 +377,17 @@ func (dev *Device) NumData() (int, error) {
 }
 
 func (dev *Device) Since() (time.Duration, error) {
+	return dev.SinceContext(context.Background())
+}
+
+// SinceContext is like Since but gives up when ctx is done.
+func (dev *Device) SinceContext(ctx context.Context) (time.Duration, error) {
 	c, err := dev.devCharByUUID(uuidReadSecondsSinceUpdate)
 	if err != nil {
 		return 0, fmt.Errorf("could not get characteristic %q: %w", uuidReadSecondsSinceUpdate, err)
 	}
 
-	raw, err := dev.read(c)
+	raw, err := dev.read(ctx, c)
 	if err != nil {
 		return 0, fmt.Errorf("could not get value: %w", err)
 	}
@@ -157,12 +404,17 @@ func (dev *Device) Since() (time.Duration, error) {
 }
 
 func (dev *Device) Interval() (time.Duration, error) {
+	return dev.IntervalContext(context.Background())
+}
+
+// IntervalContext is like Interval but gives up when ctx is done.
+func (dev *Device) IntervalContext(ctx context.Context) (time.Duration, error) {
 	c, err := dev.devCharByUUID(uuidReadInterval)
 	if err != nil {
 		return 0, fmt.Errorf("could not get characteristic %q: %w", uuidReadInterval, err)
 	}
 
-	raw, err := dev.read(c)
+	raw, err := dev.read(ctx, c)
 	if err != nil {
 		return 0, fmt.Errorf("could not get value: %w", err)
 	}
@@ -178,60 +430,414 @@ func (dev *Device) Interval() (time.Duration, error) {
 	return ago, nil
 }
 
-func (dev *Device) ReadAll() ([]Data, error) {
-	now := time.Now().UTC()
-	ago, err := dev.Since()
+// SetInterval changes the measurement interval of the device.
+// Only intervals of 1, 2, 5 and 10 minutes are supported.
+func (dev *Device) SetInterval(d time.Duration) error {
+	return dev.SetIntervalContext(context.Background(), d)
+}
+
+// SetIntervalContext is like SetInterval but gives up when ctx is done.
+func (dev *Device) SetIntervalContext(ctx context.Context, d time.Duration) error {
+	switch d {
+	case 1 * time.Minute, 2 * time.Minute, 5 * time.Minute, 10 * time.Minute:
+	default:
+		return fmt.Errorf("aranet4: unsupported interval %v (want 1m, 2m, 5m or 10m)", d)
+	}
+
+	c, err := dev.devCharByUUID(uuidWriteCmd)
 	if err != nil {
-		return nil, fmt.Errorf("could not get last measurement update: %w", err)
+		return fmt.Errorf("could not get characteristic %q: %w", uuidWriteCmd, err)
 	}
 
-	delta, err := dev.Interval()
+	cmd := []byte{cmdSetInterval, byte(d / time.Minute)}
+	err = dev.write(ctx, c, cmd)
 	if err != nil {
-		return nil, fmt.Errorf("could not get sampling: %w", err)
+		return fmt.Errorf("could not write command: %w", err)
 	}
+	return nil
+}
 
-	n, err := dev.NumData()
+func (dev *Device) ReadAll() ([]Data, error) {
+	return dev.ReadAllContext(context.Background())
+}
+
+// ReadAllContext is like ReadAll but gives up when ctx is done.
+func (dev *Device) ReadAllContext(ctx context.Context) ([]Data, error) {
+	return dev.readAllInto(ctx, nil, nil)
+}
+
+// ReadAllWithProgress is like ReadAll but reports the download progress
+// to fn, as the number of values received so far out of the total
+// number of values to download (four per sample).
+// fn is called from the goroutine handling BLE notifications and should
+// return quickly.
+func (dev *Device) ReadAllWithProgress(fn func(done, total int)) ([]Data, error) {
+	return dev.ReadAllWithProgressContext(context.Background(), fn)
+}
+
+// ReadAllWithProgressContext is like ReadAllWithProgress but gives up
+// when ctx is done.
+func (dev *Device) ReadAllWithProgressContext(ctx context.Context, fn func(done, total int)) ([]Data, error) {
+	return dev.readAllInto(ctx, nil, fn)
+}
+
+// ReadAllInto is like ReadAll but appends the samples to dst, growing it
+// as needed, and returns the extended slice.
+// The returned slice may alias dst, allowing callers to reuse a buffer
+// across calls.
+func (dev *Device) ReadAllInto(dst []Data) ([]Data, error) {
+	return dev.ReadAllIntoContext(context.Background(), dst)
+}
+
+// ReadAllIntoContext is like ReadAllInto but gives up when ctx is done.
+func (dev *Device) ReadAllIntoContext(ctx context.Context, dst []Data) ([]Data, error) {
+	return dev.readAllInto(ctx, dst, nil)
+}
+
+func (dev *Device) readAllInto(ctx context.Context, dst []Data, progress func(done, total int)) ([]Data, error) {
+	h, err := dev.history(ctx)
+	if err != nil {
+		return dst, err
+	}
+
+	off := len(dst)
+	dst = slices.Grow(dst, h.n)[:off+h.n]
+	out := dst[off:]
+	clear(out)
+	params := []byte{paramT, paramH, paramP, paramCO2}
+	for i, id := range params {
+		var fn func(beg, end int)
+		if progress != nil {
+			// only report new highs, so that progress never goes
+			// backwards when the parameter is retried.
+			seen := 0
+			fn = func(_, end int) {
+				if end <= seen {
+					return
+				}
+				seen = end
+				progress(i*h.n+end, len(params)*h.n)
+			}
+		}
+		err = dev.readParam(ctx, nil, out, id, 0, fn)
+		if err != nil {
+			return dst[:off], err
+		}
+	}
+
+	for i := range out {
+		h.fill(&out[i], i)
+	}
+
+	return dst, nil
+}
+
+// ReadRange reads count samples of the history stored on the device,
+// starting at the sample index start (0 being the oldest sample).
+// start and count must lie within the NumData samples stored on the device.
+func (dev *Device) ReadRange(start, count int) ([]Data, error) {
+	return dev.ReadRangeContext(context.Background(), start, count)
+}
+
+// ReadRangeContext is like ReadRange but gives up when ctx is done.
+func (dev *Device) ReadRangeContext(ctx context.Context, start, count int) ([]Data, error) {
+	h, err := dev.history(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("could not get total number of samples: %w", err)
+		return nil, err
 	}
-	out := make([]Data, n)
+	if start < 0 || count < 0 || start+count > h.n {
+		return nil, fmt.Errorf("aranet4: invalid range [%d, %d) (device holds %d samples)", start, start+count, h.n)
+	}
+
+	out := make([]Data, count)
 	for _, id := range []byte{paramT, paramH, paramP, paramCO2} {
-		err = dev.readN(out, id)
+		err = dev.readParam(ctx, nil, out, id, start, nil)
 		if err != nil {
-			return nil, fmt.Errorf("could not read param=%d: %w", id, err)
+			return nil, err
 		}
 	}
 
-	beg := now.Add(-ago - time.Duration(n-1)*delta)
 	for i := range out {
-		out[i].Battery = -1 // no battery information when fetching history.
-		out[i].Quality = QualityFrom(out[i].CO2)
-		out[i].Interval = delta
-		out[i].Time = beg.Add(time.Duration(i) * delta)
+		h.fill(&out[i], start+i)
 	}
 
 	return out, nil
 }
 
-func (dev *Device) read(c *ble.Characteristic) ([]byte, error) {
-	b, err := dev.dev.ReadCharacteristic(c)
-	return b, err
+// ReadAllSeq returns an iterator over the history stored on the device,
+// in increasing time order.
+//
+// Temperature, humidity and pressure are downloaded first; samples are
+// then yielded as soon as their CO2 value is received.
+// ReadAllSeq thus lets callers process samples before the download
+// completes, but it does not save memory: like ReadAll, it buffers the
+// whole history.
+// Breaking out of the loop stops the download without closing the
+// connection to the device.
+// Iteration stops at the first error, which is yielded with a zero Data.
+func (dev *Device) ReadAllSeq(ctx context.Context) iter.Seq2[Data, error] {
+	return func(yield func(Data, error) bool) {
+		h, err := dev.history(ctx)
+		if err != nil {
+			yield(Data{}, err)
+			return
+		}
+
+		out := make([]Data, h.n)
+		for _, id := range []byte{paramT, paramH, paramP} {
+			err = dev.readParam(ctx, nil, out, id, 0, nil)
+			if err != nil {
+				yield(Data{}, err)
+				return
+			}
+		}
+
+		// pending holds the CO2 values received but not yet yielded, and
+		// queued the index following them.
+		// They are copied out of out by the notification handler, which
+		// owns the CO2 values of out until the download completes: a
+		// retry may overwrite them concurrently.
+		var (
+			mu      sync.Mutex
+			pending []int
+			queued  int
+			ready   = make(chan struct{}, 1)
+			stop    = make(chan struct{})
+			errc    = make(chan error, 1)
+		)
+		go func() {
+			errc <- dev.readParam(ctx, stop, out, paramCO2, 0, func(beg, end int) {
+				mu.Lock()
+				// skip samples already queued before a retry.
+				if beg <= queued && queued < end {
+					for _, v := range out[queued:end] {
+						pending = append(pending, v.CO2)
+					}
+					queued = end
+				}
+				mu.Unlock()
+				// never block the notification handler.
+				select {
+				case ready <- struct{}{}:
+				default:
+				}
+			})
+		}()
+
+		var (
+			buf  []int // CO2 values being yielded, swapped with pending.
+			next = 0
+		)
+		for {
+			var (
+				err  error
+				done bool
+			)
+			select {
+			case <-ready:
+			case err = <-errc:
+				done = true
+			}
+
+			mu.Lock()
+			buf, pending = pending, buf[:0]
+			mu.Unlock()
+
+			for _, co2 := range buf {
+				// other fields of out are no longer written to.
+				v := Data{T: out[next].T, H: out[next].H, P: out[next].P, CO2: co2}
+				h.fill(&v, next)
+				if !yield(v, nil) {
+					if !done {
+						close(stop)
+						<-errc
+					}
+					return
+				}
+				next++
+			}
+
+			if done {
+				if err != nil {
+					yield(Data{}, err)
+				}
+				return
+			}
+		}
+	}
 }
 
-func (dev *Device) readN(dst []Data, id byte) error {
+// history describes the samples stored on the device.
+type history struct {
+	n     int           // number of samples
+	beg   time.Time     // time-stamp of the first sample
+	delta time.Duration // interval between samples
+}
+
+func (dev *Device) history(ctx context.Context) (history, error) {
+	if dev.model != Aranet4 {
+		return history{}, fmt.Errorf("aranet4: history download not supported for %v devices: %w", dev.model, errors.ErrUnsupported)
+	}
+
+	now := time.Now().UTC()
+	ago, err := dev.SinceContext(ctx)
+	if err != nil {
+		return history{}, fmt.Errorf("could not get last measurement update: %w", err)
+	}
+
+	delta, err := dev.IntervalContext(ctx)
+	if err != nil {
+		return history{}, fmt.Errorf("could not get sampling: %w", err)
+	}
+
+	n, err := dev.NumDataContext(ctx)
+	if err != nil {
+		return history{}, fmt.Errorf("could not get total number of samples: %w", err)
+	}
+
+	return history{
+		n:     n,
+		beg:   now.Add(-ago - time.Duration(n-1)*delta),
+		delta: delta,
+	}, nil
+}
+
+// fill sets the fields of the i-th sample that are not downloaded from
+// the device.
+func (h history) fill(v *Data, i int) {
+	v.Battery = -1 // no battery information when fetching history.
+	v.Quality = 0
+	if v.CO2 != -1 {
+		v.Quality = QualityFrom(v.CO2)
+	}
+	v.Interval = h.delta
+	v.Time = h.beg.Add(time.Duration(i) * h.delta)
+}
+
+// readString reads the string value of the characteristic id.
+func (dev *Device) readString(ctx context.Context, id string) (string, error) {
+	c, err := dev.devCharByUUID(id)
+	if err != nil {
+		return "", fmt.Errorf("could not get characteristic %q: %w", id, err)
+	}
+
+	raw, err := dev.read(ctx, c)
+	if err != nil {
+		return "", fmt.Errorf("could not get value: %w", err)
+	}
+	return string(raw), nil
+}
+
+func (dev *Device) read(ctx context.Context, c *ble.Characteristic) (p []byte, err error) {
+	if dev.cfg.hook != nil {
+		defer func(start time.Time) {
+			dev.cfg.hook(OpRead, time.Since(start), err)
+		}(time.Now())
+	}
+	err = dev.withContext(ctx, func() error {
+		var err error
+		p, err = dev.dev.ReadCharacteristic(c)
+		return err
+	})
+	return p, err
+}
+
+func (dev *Device) write(ctx context.Context, c *ble.Characteristic, p []byte) error {
+	return dev.withContext(ctx, func() error {
+		return dev.dev.WriteCharacteristic(c, p, false)
+	})
+}
+
+// withContext runs the BLE operation fn and returns its error, or
+// ctx.Err() if ctx is done first.
+// The BLE stack offers no way to abort a single in-flight ATT request:
+// when ctx is done, the whole connection is canceled, which makes fn
+// return, and the device is closed.
+func (dev *Device) withContext(ctx context.Context, fn func() error) error {
+	if dev.closed.Load() {
+		return ErrClosed
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	stop := context.AfterFunc(ctx, dev.abort)
+	err := fn()
+	if !stop() {
+		return ctx.Err()
+	}
+	if err != nil {
+		return dev.checkDisconnected(err)
+	}
+	return nil
+}
+
+// checkDisconnected marks the device as closed and wraps err with
+// ErrClosed if the connection to the device was lost.
+func (dev *Device) checkDisconnected(err error) error {
+	select {
+	case <-dev.dev.Disconnected():
+		dev.closed.Store(true)
+		return fmt.Errorf("device disconnected: %w: %w", ErrClosed, err)
+	default:
+		return err
+	}
+}
+
+// errStopped is returned by readN when the download is stopped through
+// its stop channel.
+var errStopped = errors.New("aranet4: history download stopped")
+
+// readParam downloads the history of parameter id into dst, retrying
+// the whole parameter pass up to dev.cfg.retries times.
+// dst[0] receives the sample at index off of the device history.
+// Parameters already stored in dst are left untouched.
+// If fn is not nil, it is called with the range of dst decoded by each
+// notification.
+// Closing stop, which may be nil, ends the download with errStopped,
+// leaving the connection open.
+// Retries are not attempted once the context is done or the connection
+// is closed.
+func (dev *Device) readParam(ctx context.Context, stop <-chan struct{}, dst []Data, id byte, off int, fn func(beg, end int)) error {
+	var err error
+	for i := 0; i <= dev.cfg.retries; i++ {
+		if dev.cfg.hook == nil {
+			err = dev.readN(ctx, stop, dst, id, off, fn)
+		} else {
+			start := time.Now()
+			err = dev.readN(ctx, stop, dst, id, off, fn)
+			dev.cfg.hook(OpReadHistory, time.Since(start), err)
+		}
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil || errors.Is(err, errStopped) || errors.Is(err, ErrClosed) {
+			return fmt.Errorf("could not read param=%d: %w", id, err)
+		}
+		dev.cfg.log().Warn("could not read history parameter", "addr", dev.addr, "param", id, "attempt", i+1, "attempts", dev.cfg.retries+1, "err", err)
+	}
+	return fmt.Errorf("could not read param=%d after %d attempts: %w", id, dev.cfg.retries+1, err)
+}
+
+func (dev *Device) readN(ctx context.Context, stop <-chan struct{}, dst []Data, id byte, off int, fn func(beg, end int)) error {
+	if len(dst) == 0 {
+		return nil
+	}
+
 	cmd := []byte{
-		0x82, 0x00, 0x00, 0x00, 0x01, 0x00, 0xff, 0xff,
+		cmdReadHistory, 0x00, 0x00, 0x00, 0x01, 0x00, 0xff, 0xff,
 	}
 	cmd[1] = id
-	binary.LittleEndian.PutUint16(cmd[4:], 0x0001)
-	binary.LittleEndian.PutUint16(cmd[6:], 0xffff)
+	// indices of the first and last requested samples, starting at 1.
+	binary.LittleEndian.PutUint16(cmd[4:], uint16(off+1))
+	binary.LittleEndian.PutUint16(cmd[6:], uint16(off+len(dst)))
 
 	c, err := dev.devCharByUUID(uuidWriteCmd)
 	if err != nil {
 		return fmt.Errorf("could not get characteristic %q: %w", uuidWriteCmd, err)
 	}
 
-	err = dev.dev.WriteCharacteristic(c, cmd, false)
+	err = dev.write(ctx, c, cmd)
 	if err != nil {
 		return fmt.Errorf("could not write command: %w", err)
 	}
@@ -241,20 +847,53 @@ func (dev *Device) readN(dst []Data, id byte) error {
 		return fmt.Errorf("could not get characteristic %q: %w", uuidReadTimeSeries, err)
 	}
 
-	errs := make(chan error)
+	// done receives the outcome of the notification stream.
+	// Only the first outcome is kept so that late notifications
+	// never block the handler.
+	done := make(chan error, 1)
+	finish := func(err error) {
+		select {
+		case done <- err:
+		default:
+		}
+	}
+
+	// stopped is set at the end of the stream, on the first error, and
+	// when readN returns, so that notifications still delivered by the
+	// BLE stack afterwards never touch dst.
+	var (
+		mu      sync.Mutex
+		stopped bool
+	)
+	defer func() {
+		mu.Lock()
+		stopped = true
+		mu.Unlock()
+	}()
+
 	handler := func(_ uint, b []byte) {
+		mu.Lock()
+		defer mu.Unlock()
+		if stopped {
+			return
+		}
+
 		err := func(p []byte) error {
 			param := p[0]
 			if param != id {
 				return fmt.Errorf("invalid parameter: got=0x%x, want=0x%x", param, id)
 			}
 
-			idx := int(binary.LittleEndian.Uint16(p[1:]) - 1)
+			idx := int(binary.LittleEndian.Uint16(p[1:])-1) - off
 			cnt := int(p[3])
 			if cnt == 0 {
-				close(errs)
+				stopped = true
+				finish(nil)
 				return nil
 			}
+			if idx < 0 {
+				return fmt.Errorf("invalid sample index %d (want >= %d)", idx+off, off)
+			}
 			max := min(idx+cnt, len(dst)) // a new sample may have appeared
 			dec := newDecoder(bytes.NewReader(p[4:]))
 			for i := idx; i < max; i++ {
@@ -263,27 +902,50 @@ func (dev *Device) readN(dst []Data, id byte) error {
 					if !errors.Is(err, ErrNoData) {
 						return fmt.Errorf("could not read param=%d, idx=%d: %w", id, i, err)
 					}
-					log.Printf("could not read param=%d, idx=%d: %+v", id, i, err)
+					dev.cfg.log().Debug("could not read history sample", "addr", dev.addr, "param", id, "idx", i, "err", err)
+					clearField(id, &dst[i])
 				}
 			}
+			if fn != nil && idx < max {
+				fn(idx, max)
+			}
 			return nil
 		}(b)
 		if err != nil {
-			errs <- err
+			// ignore the rest of the stream.
+			stopped = true
+			finish(err)
 		}
 	}
 
+	if dev.closed.Load() {
+		return ErrClosed
+	}
 	if err := dev.dev.Subscribe(c, false, handler); err != nil {
 		return fmt.Errorf("could not subscribe to characteristic %q: %w", uuidReadTimeSeries, err)
 	}
 	defer func() {
+		if dev.closed.Load() {
+			return // the connection is gone, and the subscription with it.
+		}
 		if err := dev.dev.Unsubscribe(c, false); err != nil {
-			log.Printf("could not unsubscribe from characteristic %q: %v", uuidReadTimeSeries, err)
+			dev.cfg.log().Warn("could not unsubscribe from characteristic", "addr", dev.addr, "uuid", uuidReadTimeSeries, "err", err)
 		}
 	}()
 
-	if err, ok := <-errs; ok {
-		return fmt.Errorf("could not read notified data: %w", err)
+	select {
+	case <-ctx.Done():
+		dev.abort()
+		return ctx.Err()
+	case <-dev.dev.Disconnected():
+		dev.closed.Store(true)
+		return fmt.Errorf("device disconnected: %w", ErrClosed)
+	case <-stop:
+		return errStopped
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("could not read notified data: %w", err)
+		}
 	}
 
 	return nil
@@ -0,0 +1,960 @@
+// Copyright ©2023 The aranet4 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package aranet4
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRead(t *testing.T) {
+	f := newFakeClient()
+	want := Data{
+		CO2:      812,
+		T:        21.35,
+		P:        1013.2,
+		H:        41,
+		Battery:  87,
+		Quality:  1,
+		Interval: 5 * time.Minute,
+		Model:    Aranet4,
+	}
+	f.chars[uuidReadAll] = encodeReadAll(want, 42*time.Second)
+	dev := newFakeDevice(f)
+
+	got, err := dev.Read()
+	if err != nil {
+		t.Fatalf("could not read sample: %+v", err)
+	}
+	assertNear(t, "time-stamp", got.Time, time.Now().Add(-42*time.Second))
+	got.Time = time.Time{}
+	if got != want {
+		t.Fatalf("invalid sample:\ngot= %+v\nwant=%+v", got, want)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		set  func(f *fakeClient)
+		want error
+	}{
+		{
+			name: "read-error",
+			set:  func(f *fakeClient) { f.errs[uuidReadAll] = io.ErrClosedPipe },
+			want: io.ErrClosedPipe,
+		},
+		{
+			name: "short-payload",
+			set:  func(f *fakeClient) { f.chars[uuidReadAll] = []byte{0x01, 0x02, 0x03} },
+			want: io.ErrUnexpectedEOF,
+		},
+		{
+			name: "empty-payload",
+			set:  func(f *fakeClient) { f.chars[uuidReadAll] = nil },
+			want: io.EOF,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newFakeClient()
+			tc.set(f)
+			_, err := newFakeDevice(f).Read()
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("invalid error: got=%+v, want=%v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestReadValidation(t *testing.T) {
+	f := newFakeClient()
+	f.chars[uuidReadAll] = encodeReadAll(Data{CO2: 500, T: 20, P: 100, H: 40, Battery: 90}, 0)
+
+	_, err := newFakeDevice(f).Read()
+	if err != nil {
+		t.Fatalf("unexpected error without validation: %+v", err)
+	}
+
+	_, err = newFakeDevice(f, WithValidation()).Read()
+	if !errors.Is(err, ErrInvalidData) {
+		t.Fatalf("invalid error: got=%+v, want=%v", err, ErrInvalidData)
+	}
+}
+
+func TestInfo(t *testing.T) {
+	errSerial := errors.New("read failed")
+	f := newFakeClient()
+	f.chars[uuidCommonReadSWRevision] = []byte("v1.4.19")
+	f.errs[uuidCommonReadSerialNumber] = errSerial
+	f.chars[uuidReadInterval] = le16(300)
+	f.chars[uuidReadTotalReadings] = le16(42)
+	f.chars[uuidReadSecondsSinceUpdate] = le16(10)
+	dev := newFakeDevice(f)
+
+	got, err := dev.Info()
+	if !errors.Is(err, errSerial) {
+		t.Fatalf("invalid error: got=%+v, want=%v", err, errSerial)
+	}
+	want := DeviceInfo{
+		Name:     "Aranet4 0AB1C",
+		Version:  "v1.4.19",
+		Interval: 5 * time.Minute,
+		NumData:  42,
+		Since:    10 * time.Second,
+	}
+	if got != want {
+		t.Fatalf("invalid info:\ngot= %+v\nwant=%+v", got, want)
+	}
+}
+
+func TestSetInterval(t *testing.T) {
+	f := newFakeClient()
+	f.chars[uuidReadInterval] = le16(300)
+	dev := newFakeDevice(f)
+
+	for _, d := range []time.Duration{time.Minute, 2 * time.Minute, 5 * time.Minute, 10 * time.Minute} {
+		err := dev.SetInterval(d)
+		if err != nil {
+			t.Fatalf("could not set interval %v: %+v", d, err)
+		}
+		cmd := f.writes[len(f.writes)-1]
+		if want := []byte{0x90, byte(d / time.Minute)}; !bytes.Equal(cmd, want) {
+			t.Fatalf("invalid command for %v: got=%x, want=%x", d, cmd, want)
+		}
+		got, err := dev.Interval()
+		if err != nil {
+			t.Fatalf("could not read interval: %+v", err)
+		}
+		if got != d {
+			t.Fatalf("invalid interval round-trip: got=%v, want=%v", got, d)
+		}
+	}
+}
+
+func TestSetIntervalUnsupported(t *testing.T) {
+	f := newFakeClient()
+	dev := newFakeDevice(f)
+
+	for _, d := range []time.Duration{0, 30 * time.Second, 3 * time.Minute, 90 * time.Second, time.Hour} {
+		err := dev.SetInterval(d)
+		if err == nil {
+			t.Fatalf("expected an error for interval %v", d)
+		}
+	}
+	if len(f.writes) != 0 {
+		t.Fatalf("unsupported interval written: %x", f.writes)
+	}
+}
+
+func TestReadAll(t *testing.T) {
+	const (
+		n        = 17
+		interval = 2 * time.Minute
+		ago      = 30 * time.Second
+	)
+	for _, chunk := range []int{1, 4, n, 2 * n} {
+		f := newFakeClient()
+		want := testHistory(n)
+		f.setHistory(want, interval, ago, chunk)
+		dev := newFakeDevice(f)
+
+		got, err := dev.ReadAll()
+		if err != nil {
+			t.Fatalf("chunk=%d: could not read history: %+v", chunk, err)
+		}
+		assertHistory(t, got, want, interval, ago)
+
+		cmds := f.historyWrites()
+		if len(cmds) != 4 {
+			t.Fatalf("chunk=%d: invalid number of history commands: got=%d, want=4", chunk, len(cmds))
+		}
+		for i, id := range []byte{paramT, paramH, paramP, paramCO2} {
+			want := []byte{cmdReadHistory, id, 0x00, 0x00, 0x01, 0x00, n, 0x00}
+			if !reflect.DeepEqual(cmds[i], want) {
+				t.Errorf("chunk=%d: invalid command #%d: got=%x, want=%x", chunk, i, cmds[i], want)
+			}
+		}
+	}
+}
+
+func TestReadAllNoData(t *testing.T) {
+	f := newFakeClient()
+	vs := testHistory(3)
+	f.setHistory(vs, time.Minute, 0, 3)
+	f.notify = func(cmd []byte) [][]byte {
+		notes := historyNotifications(vs, cmd, 3)
+		// second sample: no T, P nor CO2, e.g. during calibration.
+		switch cmd[1] {
+		case paramT:
+			notes[0][4+2], notes[0][4+3] = 0x00, 0x40
+		case paramP, paramCO2:
+			notes[0][4+2], notes[0][4+3] = 0x00, 0x80
+		}
+		return notes
+	}
+
+	got, err := newFakeDevice(f).ReadAll()
+	if err != nil {
+		t.Fatalf("could not read history: %+v", err)
+	}
+	if v := got[1]; v.CO2 != -1 || v.P != -1 || !math.IsNaN(v.T) || v.Quality != 0 {
+		t.Errorf("invalid missing sample: got=%+v, want absent T, P, CO2 and quality", v)
+	}
+	if got[0].CO2 != vs[0].CO2 || got[2].CO2 != vs[2].CO2 {
+		t.Errorf("invalid CO2 values: got=%d,%d, want=%d,%d", got[0].CO2, got[2].CO2, vs[0].CO2, vs[2].CO2)
+	}
+
+	// gaps are skipped by statistics.
+	want := Stats{Min: 600, Max: 620, Mean: 610, N: 2}
+	if st := Samples(got).CO2Stats(); st != want {
+		t.Errorf("invalid CO2 stats: got=%+v, want=%+v", st, want)
+	}
+	if st := Samples(got).TStats(); st.N != 2 || st.Min != vs[0].T {
+		t.Errorf("invalid T stats: got=%+v", st)
+	}
+	if st := Samples(got).PStats(); st.N != 2 || st.Min != vs[0].P {
+		t.Errorf("invalid P stats: got=%+v", st)
+	}
+}
+
+func TestReadHook(t *testing.T) {
+	type call struct {
+		op  string
+		err error
+	}
+	var (
+		f     = newFakeClient()
+		calls []call
+		errIO = errors.New("i/o error")
+	)
+	f.setHistory(testHistory(3), time.Minute, 0, 3)
+	f.chars[uuidReadAll] = encodeReadAll(testSample(), 0)
+	dev := newFakeDevice(f, WithReadHook(func(op string, d time.Duration, err error) {
+		if d < 0 {
+			t.Errorf("invalid duration for %s: %v", op, d)
+		}
+		calls = append(calls, call{op, err})
+	}))
+
+	_, err := dev.Read()
+	if err != nil {
+		t.Fatalf("could not read device: %+v", err)
+	}
+	if want := []call{{OpRead, nil}}; !slices.Equal(calls, want) {
+		t.Fatalf("invalid read calls: got=%v, want=%v", calls, want)
+	}
+
+	calls = nil
+	f.errs[uuidReadAll] = errIO
+	_, err = dev.Read()
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	if len(calls) != 1 || calls[0].op != OpRead || !errors.Is(calls[0].err, errIO) {
+		t.Fatalf("invalid failed read calls: got=%v, want=[{%s %v}]", calls, OpRead, errIO)
+	}
+
+	calls = nil
+	_, err = dev.ReadAll()
+	if err != nil {
+		t.Fatalf("could not read history: %+v", err)
+	}
+	var history []call
+	for _, c := range calls {
+		if c.op == OpReadHistory {
+			history = append(history, c)
+		}
+	}
+	if want := slices.Repeat([]call{{OpReadHistory, nil}}, 4); !slices.Equal(history, want) {
+		t.Fatalf("invalid history calls: got=%v, want=%v", history, want)
+	}
+}
+
+func TestReadHookUnset(t *testing.T) {
+	f := newFakeClient()
+	f.setHistory(testHistory(3), time.Minute, 0, 3)
+	f.chars[uuidReadAll] = encodeReadAll(testSample(), 0)
+	for _, opts := range [][]Option{nil, {WithReadHook(nil)}} {
+		dev := newFakeDevice(f, opts...)
+		if dev.cfg.hook != nil {
+			t.Fatalf("unexpected read hook")
+		}
+		_, err := dev.Read()
+		if err != nil {
+			t.Fatalf("could not read device: %+v", err)
+		}
+		_, err = dev.ReadAll()
+		if err != nil {
+			t.Fatalf("could not read history: %+v", err)
+		}
+	}
+}
+
+func TestReadAllDisconnected(t *testing.T) {
+	f := newFakeClient()
+	f.setHistory(testHistory(3), time.Minute, 0, 3)
+	f.notify = func(cmd []byte) [][]byte {
+		go f.CancelConnection() // connection lost during the download.
+		return nil
+	}
+
+	var attempts atomic.Int32
+	dev := newFakeDevice(f, WithRetries(3), WithReadHook(func(op string, _ time.Duration, _ error) {
+		if op == OpReadHistory {
+			attempts.Add(1)
+		}
+	}))
+	_, err := dev.ReadAll()
+	if !errors.Is(err, ErrClosed) {
+		t.Fatalf("invalid error: got=%+v, want=%v", err, ErrClosed)
+	}
+	if got := attempts.Load(); got != 1 {
+		t.Fatalf("invalid number of attempts: got=%d, want=1", got)
+	}
+}
+
+func TestReadAllInvalidParam(t *testing.T) {
+	f := newFakeClient()
+	vs := testHistory(3)
+	f.setHistory(vs, time.Minute, 0, 3)
+	f.notify = func(cmd []byte) [][]byte {
+		notes := historyNotifications(vs, cmd, 3)
+		if cmd[1] == paramH {
+			notes[0][0] = paramP
+		}
+		return notes
+	}
+
+	_, err := newFakeDevice(f, WithRetries(0)).ReadAll()
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+}
+
+func TestReadRange(t *testing.T) {
+	const (
+		interval = time.Minute
+		ago      = 10 * time.Second
+	)
+	f := newFakeClient()
+	vs := testHistory(10)
+	f.setHistory(vs, interval, ago, 3)
+	dev := newFakeDevice(f)
+
+	got, err := dev.ReadRange(4, 5)
+	if err != nil {
+		t.Fatalf("could not read range: %+v", err)
+	}
+	if len(got) != 5 {
+		t.Fatalf("invalid number of samples: got=%d, want=5", len(got))
+	}
+	for i, v := range got {
+		w := vs[4+i]
+		if v.CO2 != w.CO2 || v.T != w.T || v.H != w.H || v.P != w.P {
+			t.Errorf("invalid sample #%d:\ngot= %+v\nwant=%+v", i, v, w)
+		}
+	}
+	assertNear(t, "last time-stamp", got[4].Time, time.Now().Add(-ago-interval))
+
+	_, err = dev.ReadRange(8, 3)
+	if err == nil {
+		t.Fatalf("expected an error for an out of range request")
+	}
+}
+
+func TestReadAllInto(t *testing.T) {
+	f := newFakeClient()
+	want := testHistory(5)
+	f.setHistory(want, time.Minute, 0, 2)
+	dev := newFakeDevice(f)
+
+	buf := make([]Data, 1, 16)
+	got, err := dev.ReadAllInto(buf)
+	if err != nil {
+		t.Fatalf("could not read history: %+v", err)
+	}
+	if len(got) != 6 || &got[0] != &buf[0] {
+		t.Fatalf("invalid buffer reuse: len=%d, aliased=%v", len(got), &got[0] == &buf[0])
+	}
+	assertHistory(t, got[1:], want, time.Minute, 0)
+}
+
+func TestReadAllSeq(t *testing.T) {
+	const n = 17
+	for _, chunk := range []int{1, 4, 2 * n} {
+		f := newFakeClient()
+		want := testHistory(n)
+		f.setHistory(want, time.Minute, 0, chunk)
+		dev := newFakeDevice(f)
+
+		var got []Data
+		for v, err := range dev.ReadAllSeq(context.Background()) {
+			if err != nil {
+				t.Fatalf("chunk=%d: could not read history: %+v", chunk, err)
+			}
+			got = append(got, v)
+		}
+		assertHistory(t, got, want, time.Minute, 0)
+	}
+}
+
+func TestReadAllSeqBreak(t *testing.T) {
+	f := newFakeClient()
+	f.setHistory(testHistory(64), time.Minute, 0, 1)
+	f.chars[uuidReadAll] = encodeReadAll(testSample(), 0)
+	f.delay = time.Millisecond
+	dev := newFakeDevice(f)
+
+	n := 0
+	for _, err := range dev.ReadAllSeq(context.Background()) {
+		if err != nil {
+			t.Fatalf("could not read history: %+v", err)
+		}
+		n++
+		if n == 3 {
+			break
+		}
+	}
+
+	f.mu.Lock()
+	cancels, sub := f.cancels, f.sub
+	f.mu.Unlock()
+	if cancels != 0 {
+		t.Fatalf("connection canceled on break: cancels=%d", cancels)
+	}
+	if sub != nil {
+		t.Fatalf("history notifications still subscribed after break")
+	}
+	_, err := dev.Read()
+	if err != nil {
+		t.Fatalf("could not read device after break: %+v", err)
+	}
+}
+
+func TestReadAllSeqRetry(t *testing.T) {
+	const n = 10
+	var (
+		f     = newFakeClient()
+		want  = testHistory(n)
+		fails = 0
+	)
+	f.setHistory(want, time.Minute, 0, 3)
+	f.notify = func(cmd []byte) [][]byte {
+		notes := historyNotifications(want, cmd, 3)
+		if cmd[1] == paramCO2 && fails == 0 {
+			// the first CO2 pass breaks after two notifications.
+			fails++
+			notes[2][0] = paramT
+		}
+		return notes
+	}
+	dev := newFakeDevice(f, WithRetries(1))
+
+	var got []Data
+	for v, err := range dev.ReadAllSeq(context.Background()) {
+		if err != nil {
+			t.Fatalf("could not read history: %+v", err)
+		}
+		got = append(got, v)
+	}
+	assertHistory(t, got, want, time.Minute, 0)
+}
+
+func TestReadAllSeqError(t *testing.T) {
+	f := newFakeClient()
+	f.setHistory(testHistory(4), time.Minute, 0, 1)
+	f.notify = func(cmd []byte) [][]byte {
+		if cmd[1] == paramCO2 {
+			return [][]byte{{paramT, 1, 0, 1, 0, 0}} // wrong parameter.
+		}
+		return historyNotifications(testHistory(4), cmd, 1)
+	}
+	dev := newFakeDevice(f)
+
+	var errs int
+	for v, err := range dev.ReadAllSeq(context.Background()) {
+		if err == nil {
+			t.Fatalf("unexpected sample: %+v", v)
+		}
+		errs++
+	}
+	if errs != 1 {
+		t.Fatalf("invalid number of errors: got=%d, want=1", errs)
+	}
+}
+
+func BenchmarkReadAll(b *testing.B) {
+	f := newFakeClient()
+	f.setHistory(testHistory(512), time.Minute, 0, 64)
+	dev := newFakeDevice(f)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, err := dev.ReadAll()
+		if err != nil {
+			b.Fatalf("could not read history: %+v", err)
+		}
+	}
+}
+
+func BenchmarkReadAllInto(b *testing.B) {
+	f := newFakeClient()
+	f.setHistory(testHistory(512), time.Minute, 0, 64)
+	dev := newFakeDevice(f)
+
+	var (
+		buf []Data
+		err error
+	)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf, err = dev.ReadAllInto(buf[:0])
+		if err != nil {
+			b.Fatalf("could not read history: %+v", err)
+		}
+	}
+}
+
+func BenchmarkReadAllSeq(b *testing.B) {
+	f := newFakeClient()
+	f.setHistory(testHistory(512), time.Minute, 0, 64)
+	dev := newFakeDevice(f)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, err := range dev.ReadAllSeq(context.Background()) {
+			if err != nil {
+				b.Fatalf("could not read history: %+v", err)
+			}
+		}
+	}
+}
+
+// assertHistory checks got holds the history samples want, the last one
+// measured ago ago.
+func assertHistory(t *testing.T, got, want []Data, interval, ago time.Duration) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("invalid number of samples: got=%d, want=%d", len(got), len(want))
+	}
+	for i, v := range got {
+		w := want[i]
+		switch {
+		case v.CO2 != w.CO2, v.T != w.T, v.H != w.H, v.P != w.P:
+			t.Errorf("invalid sample #%d:\ngot= %+v\nwant=%+v", i, v, w)
+		case v.Battery != -1, v.Interval != interval, v.Quality != QualityFrom(w.CO2):
+			t.Errorf("invalid metadata for sample #%d: %+v", i, v)
+		}
+		if i > 0 && v.Time.Sub(got[i-1].Time) != interval {
+			t.Errorf("invalid spacing of sample #%d: got=%v, want=%v", i, v.Time.Sub(got[i-1].Time), interval)
+		}
+	}
+	assertNear(t, "last time-stamp", got[len(got)-1].Time, time.Now().Add(-ago))
+}
+
+func TestReadContextCancel(t *testing.T) {
+	f := newFakeClient()
+	f.block[uuidReadAll] = true
+	dev := newFakeDevice(f)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := dev.ReadContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("invalid error: got=%+v, want=%v", err, context.DeadlineExceeded)
+	}
+	if f.cancels != 1 {
+		t.Fatalf("in-flight read not aborted: cancels=%d", f.cancels)
+	}
+
+	_, err = dev.Read()
+	if !errors.Is(err, ErrClosed) {
+		t.Fatalf("invalid error after abort: got=%+v, want=%v", err, ErrClosed)
+	}
+	err = dev.Close()
+	if err != nil {
+		t.Fatalf("could not close aborted device: %+v", err)
+	}
+	if f.cancels != 1 {
+		t.Fatalf("connection canceled twice: cancels=%d", f.cancels)
+	}
+}
+
+func TestContextVariants(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		char string
+		fn   func(ctx context.Context, dev *Device) error
+	}{
+		{"SerialNumber", uuidCommonReadSerialNumber, func(ctx context.Context, dev *Device) error {
+			_, err := dev.SerialNumberContext(ctx)
+			return err
+		}},
+		{"Info", uuidCommonReadSerialNumber, func(ctx context.Context, dev *Device) error {
+			_, err := dev.InfoContext(ctx)
+			return err
+		}},
+		{"Battery", uuidCommonReadBattery, func(ctx context.Context, dev *Device) error {
+			_, err := dev.BatteryContext(ctx)
+			return err
+		}},
+		{"ReadRange", uuidReadSecondsSinceUpdate, func(ctx context.Context, dev *Device) error {
+			_, err := dev.ReadRangeContext(ctx, 0, 1)
+			return err
+		}},
+		{"BuzzerConfig", uuidReadSensorState, func(ctx context.Context, dev *Device) error {
+			_, err := dev.BuzzerConfigContext(ctx)
+			return err
+		}},
+		{"SetBuzzerConfig", uuidReadSensorState, func(ctx context.Context, dev *Device) error {
+			return dev.SetBuzzerConfigContext(ctx, BuzzerConfig{Yellow: 1000, Red: 1400})
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newFakeClient()
+			f.block[tc.char] = true
+			dev := newFakeDevice(f)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			err := tc.fn(ctx, dev)
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("invalid error: got=%+v, want=%v", err, context.DeadlineExceeded)
+			}
+			if f.cancels != 1 {
+				t.Fatalf("in-flight read not aborted: cancels=%d", f.cancels)
+			}
+		})
+	}
+}
+
+func TestSetIntervalContextDone(t *testing.T) {
+	f := newFakeClient()
+	dev := newFakeDevice(f)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := dev.SetIntervalContext(ctx, time.Minute)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("invalid error: got=%+v, want=%v", err, context.Canceled)
+	}
+	if len(f.writes) != 0 {
+		t.Fatalf("command written with a canceled context: %x", f.writes)
+	}
+}
+
+func TestReadContextDone(t *testing.T) {
+	f := newFakeClient()
+	f.chars[uuidReadAll] = encodeReadAll(Data{CO2: 500}, 0)
+	dev := newFakeDevice(f)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := dev.ReadContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("invalid error: got=%+v, want=%v", err, context.Canceled)
+	}
+	if f.cancels != 0 {
+		t.Fatalf("connection canceled without in-flight operation")
+	}
+	_, err = dev.Read()
+	if err != nil {
+		t.Fatalf("could not read sample: %+v", err)
+	}
+}
+
+func TestReadNCancel(t *testing.T) {
+	f := newFakeClient()
+	vs := testHistory(200)
+	f.setHistory(vs, time.Minute, 0, 1)
+	f.delay = time.Millisecond
+	f.notify = func(cmd []byte) [][]byte {
+		notes := historyNotifications(vs, cmd, 1)
+		return notes[:len(notes)-1] // never ends.
+	}
+	dev := newFakeDevice(f)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	dst := make([]Data, len(vs))
+	err := dev.readN(ctx, nil, dst, paramCO2, 0, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("invalid error: got=%+v, want=%v", err, context.DeadlineExceeded)
+	}
+	if f.cancels != 1 {
+		t.Fatalf("notification stream not aborted: cancels=%d", f.cancels)
+	}
+
+	// notifications still delivered must not be decoded into dst.
+	snap := slices.Clone(dst)
+	time.Sleep(20 * time.Millisecond)
+	if !slices.Equal(dst, snap) {
+		t.Fatalf("dst modified after readN returned")
+	}
+}
+
+// setDial makes reconnections call fn, for the duration of the test.
+func setDial(t *testing.T, fn func(ctx context.Context, addr string, cfg config) (*Device, error)) {
+	t.Helper()
+	old := dialDevice
+	dialDevice = fn
+	t.Cleanup(func() { dialDevice = old })
+}
+
+func TestDialModel(t *testing.T) {
+	const addr = "F5:6C:BE:D5:61:47"
+	for _, tc := range []struct {
+		number string
+		want   Model
+	}{
+		{"Aranet4 HOME", Aranet4},
+		{"Aranet2 HOME", Aranet2},
+	} {
+		f := newFakeClient()
+		f.chars[uuidCommonReadModelNumber] = []byte(tc.number)
+		dev, err := dial(context.Background(), addr, newConfig([]Option{WithDevice(dialFake(addr, f))}))
+		if err != nil {
+			t.Fatalf("%s: could not dial device: %+v", tc.number, err)
+		}
+		if got := dev.Model(); got != tc.want {
+			t.Fatalf("%s: invalid model: got=%v, want=%v", tc.number, got, tc.want)
+		}
+	}
+}
+
+func TestDialModelError(t *testing.T) {
+	const addr = "F5:6C:BE:D5:61:47"
+	f := newFakeClient()
+	f.errs[uuidCommonReadModelNumber] = errors.New("read failed")
+
+	_, err := dial(context.Background(), addr, newConfig([]Option{WithDevice(dialFake(addr, f))}))
+	if err == nil {
+		t.Fatalf("expected an error when the model number can not be read")
+	}
+	if f.cancels != 1 {
+		t.Fatalf("connection not closed: cancels=%d", f.cancels)
+	}
+}
+
+func TestUnknownModelUnsupported(t *testing.T) {
+	const addr = "F5:6C:BE:D5:61:47"
+	f := newFakeClient()
+	f.chars[uuidCommonReadModelNumber] = []byte("Aranet Radiation")
+	f.chars[uuidReadAll] = encodeReadAll(testSample(), 0)
+	f.setHistory(testHistory(4), time.Minute, 0, 4)
+
+	dev, err := dial(context.Background(), addr, newConfig([]Option{WithDevice(dialFake(addr, f))}))
+	if err != nil {
+		t.Fatalf("could not dial device: %+v", err)
+	}
+	if got := dev.Model(); got != UnknownModel {
+		t.Fatalf("invalid model: got=%v, want=%v", got, UnknownModel)
+	}
+
+	_, err = dev.Read()
+	if !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("invalid read error: got=%+v, want=%v", err, errors.ErrUnsupported)
+	}
+	_, err = dev.ReadAll()
+	if !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("invalid history error: got=%+v, want=%v", err, errors.ErrUnsupported)
+	}
+	_, err = dev.CalibrationState()
+	if !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("invalid calibration error: got=%+v, want=%v", err, errors.ErrUnsupported)
+	}
+	_, err = dev.BuzzerConfig()
+	if !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("invalid buzzer error: got=%+v, want=%v", err, errors.ErrUnsupported)
+	}
+}
+
+func TestReadWithRetry(t *testing.T) {
+	f1 := newFakeClient()
+	f1.errs[uuidReadAll] = io.ErrClosedPipe
+	dev := newFakeDevice(f1)
+
+	f2 := newFakeClient()
+	f2.chars[uuidReadAll] = encodeReadAll(Data{CO2: 640, T: 20}, 0)
+	dials := 0
+	setDial(t, func(ctx context.Context, addr string, cfg config) (*Device, error) {
+		dials++
+		return newFakeDevice(f2), nil
+	})
+
+	got, err := dev.ReadWithRetry(context.Background(), 3, time.Millisecond)
+	if err != nil {
+		t.Fatalf("could not read sample: %+v", err)
+	}
+	if got.CO2 != 640 {
+		t.Fatalf("invalid CO2: got=%d, want=640", got.CO2)
+	}
+	if dials != 1 || f1.cancels != 1 {
+		t.Fatalf("invalid reconnection: dials=%d, cancels=%d", dials, f1.cancels)
+	}
+}
+
+func TestReadWithRetryReconnectFails(t *testing.T) {
+	f := newFakeClient()
+	f.errs[uuidReadAll] = io.ErrClosedPipe
+	dev := newFakeDevice(f)
+	setDial(t, func(ctx context.Context, addr string, cfg config) (*Device, error) {
+		return nil, ErrConnectTimeout
+	})
+
+	_, err := dev.ReadWithRetry(context.Background(), 2, time.Millisecond)
+	if !errors.Is(err, ErrConnectTimeout) {
+		t.Fatalf("invalid error: got=%+v, want=%v", err, ErrConnectTimeout)
+	}
+
+	// the device must stay usable, reporting it is closed.
+	_, err = dev.Read()
+	if !errors.Is(err, ErrClosed) {
+		t.Fatalf("invalid error after failed reconnection: got=%+v, want=%v", err, ErrClosed)
+	}
+	_, err = dev.ReadAll()
+	if !errors.Is(err, ErrClosed) {
+		t.Fatalf("invalid error after failed reconnection: got=%+v, want=%v", err, ErrClosed)
+	}
+	err = dev.Close()
+	if err != nil {
+		t.Fatalf("could not close device: %+v", err)
+	}
+}
+
+func TestReadWithRetryAttempts(t *testing.T) {
+	for _, attempts := range []int{-1, 0, 1} {
+		f := newFakeClient()
+		f.errs[uuidReadAll] = io.ErrClosedPipe
+		dev := newFakeDevice(f)
+		setDial(t, func(ctx context.Context, addr string, cfg config) (*Device, error) {
+			t.Fatalf("attempts=%d: unexpected reconnection", attempts)
+			return nil, nil
+		})
+
+		_, err := dev.ReadWithRetry(context.Background(), attempts, time.Millisecond)
+		if !errors.Is(err, io.ErrClosedPipe) {
+			t.Fatalf("attempts=%d: invalid error: got=%+v, want=%v", attempts, err, io.ErrClosedPipe)
+		}
+		if strings.Contains(err.Error(), "%!") {
+			t.Fatalf("attempts=%d: invalid error message: %q", attempts, err)
+		}
+	}
+}
+
+func TestReadAllRetryParam(t *testing.T) {
+	const n = 12
+	var (
+		f     = newFakeClient()
+		vs    = testHistory(n)
+		fails = 0
+	)
+	f.setHistory(vs, time.Minute, 0, 5)
+	f.notify = func(cmd []byte) [][]byte {
+		notes := historyNotifications(vs, cmd, 5)
+		if cmd[1] == paramCO2 && fails == 0 {
+			// the first CO2 pass breaks after one notification.
+			fails++
+			notes[1][0] = paramT
+		}
+		return notes
+	}
+	dev := newFakeDevice(f, WithRetries(1))
+
+	got, err := dev.ReadAll()
+	if err != nil {
+		t.Fatalf("could not read history: %+v", err)
+	}
+	assertHistory(t, got, vs, time.Minute, 0)
+
+	// only the CO2 parameter is downloaded twice.
+	var ids []byte
+	for _, cmd := range f.historyWrites() {
+		ids = append(ids, cmd[1])
+	}
+	want := []byte{paramT, paramH, paramP, paramCO2, paramCO2}
+	if !slices.Equal(ids, want) {
+		t.Fatalf("invalid history commands: got=%v, want=%v", ids, want)
+	}
+}
+
+func TestReadAllWithProgress(t *testing.T) {
+	const n = 12
+	var (
+		f     = newFakeClient()
+		vs    = testHistory(n)
+		fails = 0
+	)
+	f.setHistory(vs, time.Minute, 0, 5)
+	f.notify = func(cmd []byte) [][]byte {
+		notes := historyNotifications(vs, cmd, 5)
+		if cmd[1] == paramH && fails == 0 {
+			// the first humidity pass breaks after one notification.
+			fails++
+			notes[1][0] = paramT
+		}
+		return notes
+	}
+	dev := newFakeDevice(f, WithRetries(1))
+
+	var dones []int
+	got, err := dev.ReadAllWithProgress(func(done, total int) {
+		if total != 4*n {
+			t.Errorf("invalid total: got=%d, want=%d", total, 4*n)
+		}
+		dones = append(dones, done)
+	})
+	if err != nil {
+		t.Fatalf("could not read history: %+v", err)
+	}
+	assertHistory(t, got, vs, time.Minute, 0)
+
+	want := []int{
+		5, 10, 12, // temperature
+		17, 22, 24, // humidity, retried after the first notification
+		29, 34, 36, // pressure
+		41, 46, 48, // CO2
+	}
+	if !slices.Equal(dones, want) {
+		t.Fatalf("invalid progress: got=%v, want=%v", dones, want)
+	}
+}
+
+func TestReadAllRetryParamExhausted(t *testing.T) {
+	f := newFakeClient()
+	vs := testHistory(6)
+	f.setHistory(vs, time.Minute, 0, 2)
+	f.notify = func(cmd []byte) [][]byte {
+		notes := historyNotifications(vs, cmd, 2)
+		if cmd[1] == paramP {
+			notes[1][0] = paramT
+		}
+		return notes
+	}
+	dev := newFakeDevice(f, WithRetries(2))
+
+	_, err := dev.ReadAll()
+	if err == nil || !strings.Contains(err.Error(), "param=3 after 3 attempts") {
+		t.Fatalf("invalid error: %v", err)
+	}
+
+	var ids []byte
+	for _, cmd := range f.historyWrites() {
+		ids = append(ids, cmd[1])
+	}
+	want := []byte{paramT, paramH, paramP, paramP, paramP}
+	if !slices.Equal(ids, want) {
+		t.Fatalf("invalid history commands: got=%v, want=%v", ids, want)
+	}
+}
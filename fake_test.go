@@ -0,0 +1,377 @@
+// Copyright ©2023 The aranet4 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package aranet4
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rigado/ble"
+)
+
+// fakeClient is an in-memory client standing in for an Aranet4 device.
+//
+// Reads of a characteristic return its canned payload from chars, or its
+// error from errs.
+// Writes are recorded, and interval commands change the interval read
+// back from the device; after a history command is written, subscribing to
+// the uuidReadTimeSeries characteristic replays the notifications scripted
+// by notify for that command.
+type fakeClient struct {
+	ble.Client // nil: only the methods used by Device are implemented.
+
+	mu     sync.Mutex
+	chars  map[string][]byte // canned payloads, by characteristic UUID
+	errs   map[string]error  // read errors, by characteristic UUID
+	block  map[string]bool   // reads blocking until the connection is canceled
+	notify func(cmd []byte) [][]byte
+	delay  time.Duration // delay before each notification
+
+	writes [][]byte // values written to the command characteristic
+	cmd    []byte   // last history command
+	sub    *fakeSub // current subscription, if any
+
+	cancels int // number of calls to CancelConnection
+	done    chan struct{}
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{
+		chars: map[string][]byte{
+			uuidCommonReadModelNumber: []byte("Aranet4 HOME"),
+		},
+		errs:  make(map[string]error),
+		block: make(map[string]bool),
+		done:  make(chan struct{}),
+	}
+}
+
+// fakeSub is a subscription to notifications of a fakeClient.
+type fakeSub struct {
+	mu      sync.Mutex
+	stopped bool
+}
+
+func (sub *fakeSub) active() bool {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	return !sub.stopped
+}
+
+func (f *fakeClient) Name() string { return "Aranet4 0AB1C" }
+
+func (f *fakeClient) DiscoverProfile(force bool) (*ble.Profile, error) {
+	return fakeProfile(), nil
+}
+
+func (f *fakeClient) ReadCharacteristic(c *ble.Characteristic) ([]byte, error) {
+	id := charID(c)
+
+	f.mu.Lock()
+	var (
+		p     = f.chars[id]
+		err   = f.errs[id]
+		block = f.block[id]
+	)
+	f.mu.Unlock()
+
+	if block {
+		<-f.done
+	}
+	select {
+	case <-f.done:
+		return nil, io.ErrClosedPipe
+	default:
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), p...), nil
+}
+
+func (f *fakeClient) WriteCharacteristic(c *ble.Characteristic, p []byte, noRsp bool) error {
+	select {
+	case <-f.done:
+		return io.ErrClosedPipe
+	default:
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p = append([]byte(nil), p...)
+	f.writes = append(f.writes, p)
+	switch {
+	case len(p) > 0 && p[0] == cmdReadHistory:
+		f.cmd = p
+	case len(p) == 2 && p[0] == cmdSetInterval:
+		f.chars[uuidReadInterval] = le16(int(p[1]) * 60)
+	}
+	return nil
+}
+
+func (f *fakeClient) Subscribe(c *ble.Characteristic, ind bool, h ble.NotificationHandler) error {
+	select {
+	case <-f.done:
+		return io.ErrClosedPipe
+	default:
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if charID(c) != uuidReadTimeSeries || f.notify == nil || f.cmd == nil {
+		return nil
+	}
+
+	var (
+		sub   = &fakeSub{}
+		notes = f.notify(f.cmd)
+		delay = f.delay
+	)
+	f.sub = sub
+	go func() {
+		for _, p := range notes {
+			time.Sleep(delay)
+			if !sub.active() {
+				return
+			}
+			h(0, p)
+		}
+	}()
+	return nil
+}
+
+func (f *fakeClient) Unsubscribe(c *ble.Characteristic, ind bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.sub != nil {
+		f.sub.mu.Lock()
+		f.sub.stopped = true
+		f.sub.mu.Unlock()
+		f.sub = nil
+	}
+	return nil
+}
+
+func (f *fakeClient) CancelConnection() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cancels++
+	select {
+	case <-f.done:
+	default:
+		close(f.done)
+	}
+	return nil
+}
+
+func (f *fakeClient) Disconnected() <-chan struct{} {
+	return f.done
+}
+
+// historyWrites returns the history commands written to f.
+func (f *fakeClient) historyWrites() [][]byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var cmds [][]byte
+	for _, p := range f.writes {
+		if p[0] == cmdReadHistory {
+			cmds = append(cmds, p)
+		}
+	}
+	return cmds
+}
+
+var (
+	_ client     = (*fakeClient)(nil)
+	_ ble.Client = (*fakeClient)(nil)
+)
+
+// fakeChars lists the characteristics exposed by a fake device.
+var fakeChars = []string{
+	uuidWriteCmd,
+	uuidReadSample,
+	uuidReadAll,
+	uuidReadInterval,
+	uuidReadTimeSeries,
+	uuidReadSecondsSinceUpdate,
+	uuidReadTotalReadings,
+	uuidReadSampleAranet2,
+	uuidReadSensorState,
+	uuidCommonReadManufacturerName,
+	uuidCommonReadModelNumber,
+	uuidCommonReadSerialNumber,
+	uuidCommonReadSWRevision,
+	uuidCommonReadHWRevision,
+	uuidCommonReadBattery,
+}
+
+// charID returns the UUID of c, as listed in fakeChars.
+func charID(c *ble.Characteristic) string {
+	for _, id := range fakeChars {
+		if ble.MustParse(id).Equal(c.UUID) {
+			return id
+		}
+	}
+	return c.UUID.String()
+}
+
+// fakeProfile returns the profile of a fake device.
+func fakeProfile() *ble.Profile {
+	svc := &ble.Service{UUID: ble.MustParse(uuidDeviceService)}
+	for _, id := range fakeChars {
+		svc.Characteristics = append(svc.Characteristics, &ble.Characteristic{
+			UUID: ble.MustParse(id),
+		})
+	}
+	return &ble.Profile{Services: []*ble.Service{svc}}
+}
+
+// newFakeDevice returns an Aranet4 Device backed by f.
+func newFakeDevice(f *fakeClient, opts ...Option) *Device {
+	return &Device{
+		addr:    "F5:6C:BE:D5:61:47",
+		name:    f.Name(),
+		dev:     f,
+		profile: fakeProfile(),
+		model:   Aranet4,
+		cfg:     newConfig(opts),
+	}
+}
+
+// fakeAdapter is a BLE adapter advertising advs, and connecting to them
+// with dial.
+type fakeAdapter struct {
+	ble.Device // nil: only Scan and Dial are implemented.
+
+	advs []fakeAdv
+	dial func(ctx context.Context, a ble.Addr) (ble.Client, error)
+}
+
+func (d *fakeAdapter) Scan(ctx context.Context, allowDup bool, h ble.AdvHandler) error {
+	for _, a := range d.advs {
+		h(a)
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (d *fakeAdapter) Dial(ctx context.Context, a ble.Addr) (ble.Client, error) {
+	return d.dial(ctx, a)
+}
+
+// fakeAdv is an advertisement from addr, of the given address type.
+type fakeAdv struct {
+	ble.Advertisement // nil: only Addr and AddrType are implemented.
+
+	addr string
+	typ  uint8
+}
+
+func (a fakeAdv) Addr() ble.Addr  { return ble.NewAddr(a.addr) }
+func (a fakeAdv) AddrType() uint8 { return a.typ }
+
+// dialFake returns an adapter connecting to f, advertised at addr.
+func dialFake(addr string, f *fakeClient) *fakeAdapter {
+	return &fakeAdapter{
+		advs: []fakeAdv{{addr: addr}},
+		dial: func(context.Context, ble.Addr) (ble.Client, error) {
+			return f, nil
+		},
+	}
+}
+
+// setHistory makes f hold the samples vs, measured every interval, the
+// last one ago seconds ago.
+// History notifications carry up to chunk samples each.
+func (f *fakeClient) setHistory(vs []Data, interval, ago time.Duration, chunk int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.chars[uuidReadTotalReadings] = le16(len(vs))
+	f.chars[uuidReadInterval] = le16(int(interval / time.Second))
+	f.chars[uuidReadSecondsSinceUpdate] = le16(int(ago / time.Second))
+	f.notify = func(cmd []byte) [][]byte {
+		return historyNotifications(vs, cmd, chunk)
+	}
+}
+
+// historyNotifications returns the notifications sent by a device holding
+// the samples vs in response to the history command cmd, followed by the
+// end-of-stream marker.
+func historyNotifications(vs []Data, cmd []byte, chunk int) [][]byte {
+	var (
+		id  = cmd[1]
+		beg = int(binary.LittleEndian.Uint16(cmd[4:])) - 1
+		end = min(int(binary.LittleEndian.Uint16(cmd[6:])), len(vs))
+	)
+	var notes [][]byte
+	for i := beg; i < end; i += chunk {
+		n := min(chunk, end-i)
+		p := []byte{id}
+		p = binary.LittleEndian.AppendUint16(p, uint16(i+1))
+		p = append(p, byte(n))
+		for _, v := range vs[i : i+n] {
+			p = appendField(p, id, v)
+		}
+		notes = append(notes, p)
+	}
+	return append(notes, []byte{id, 0, 0, 0})
+}
+
+// appendField appends the history encoding of the parameter id of v.
+func appendField(p []byte, id byte, v Data) []byte {
+	switch id {
+	case paramT:
+		return binary.LittleEndian.AppendUint16(p, uint16(math.Round(v.T*20)))
+	case paramH:
+		return append(p, byte(v.H))
+	case paramP:
+		return binary.LittleEndian.AppendUint16(p, uint16(math.Round(v.P*10)))
+	case paramCO2:
+		return binary.LittleEndian.AppendUint16(p, uint16(v.CO2))
+	default:
+		panic("unknown parameter")
+	}
+}
+
+// encodeReadAll returns the uuidReadAll payload of v, measured ago ago.
+func encodeReadAll(v Data, ago time.Duration) []byte {
+	p := binary.LittleEndian.AppendUint16(nil, uint16(v.CO2))
+	p = binary.LittleEndian.AppendUint16(p, uint16(math.Round(v.T*20)))
+	p = binary.LittleEndian.AppendUint16(p, uint16(math.Round(v.P*10)))
+	p = append(p, byte(v.H), byte(v.Battery), byte(v.Quality))
+	p = binary.LittleEndian.AppendUint16(p, uint16(v.Interval/time.Second))
+	p = binary.LittleEndian.AppendUint16(p, uint16(ago/time.Second))
+	return p
+}
+
+func le16(v int) []byte {
+	return binary.LittleEndian.AppendUint16(nil, uint16(v))
+}
+
+// testHistory returns n plausible history samples.
+func testHistory(n int) []Data {
+	vs := make([]Data, n)
+	for i := range vs {
+		vs[i] = Data{
+			T:   20 + float64(i)*0.05,
+			H:   float64(40 + i%10),
+			P:   1000 + float64(i)*0.1,
+			CO2: 600 + 10*i,
+		}
+	}
+	return vs
+}
+
+func assertNear(t *testing.T, name string, got, want time.Time) {
+	t.Helper()
+	if d := got.Sub(want); d < -2*time.Second || d > 2*time.Second {
+		t.Errorf("invalid %s: got=%v, want=%v", name, got, want)
+	}
+}
@@ -0,0 +1,295 @@
+// Copyright ©2023 The aranet4 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package aranet4
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// TimeFormat describes how time-stamps are encoded in JSON.
+type TimeFormat int
+
+const (
+	TimeRFC3339   TimeFormat = iota // RFC3339 string (default)
+	TimeUnix                        // seconds since the Unix epoch
+	TimeUnixMilli                   // milliseconds since the Unix epoch
+)
+
+func (tf TimeFormat) String() string {
+	switch tf {
+	case TimeRFC3339:
+		return "rfc3339"
+	case TimeUnix:
+		return "unix"
+	case TimeUnixMilli:
+		return "unix-milli"
+	default:
+		return fmt.Sprintf("TimeFormat(%d)", int(tf))
+	}
+}
+
+// jsonData is the JSON representation of Data:
+//
+//	{
+//	  "time":          "2006-01-02T15:04:05Z", // RFC3339, see TimeFormat
+//	  "co2_ppm":       800,                    // CO2 concentration, in ppm
+//	  "temperature_c": 21.5,                   // temperature, in °C
+//	  "humidity_pct":  40,                     // relative humidity, in %
+//	  "pressure_hpa":  1013.2,                 // atmospheric pressure, in hPa
+//	  "battery_pct":   90,                     // battery level, in %
+//	  "quality":       "green",                // see Quality
+//	  "interval_s":    300,                    // measurement interval, in seconds
+//	  "model":         "aranet2"               // see Model, omitted for Aranet4
+//	}
+//
+// CO2, pressure and quality are null when absent, as for Aranet2 samples.
+// Temperature is null when absent from a history sample.
+type jsonData struct {
+	Time     json.RawMessage `json:"time"`
+	CO2      *int            `json:"co2_ppm"`
+	T        *float64        `json:"temperature_c"`
+	H        float64         `json:"humidity_pct"`
+	P        *float64        `json:"pressure_hpa"`
+	Battery  int             `json:"battery_pct"`
+	Quality  *Quality        `json:"quality"`
+	Interval float64         `json:"interval_s"`
+	Model    Model           `json:"model,omitempty"`
+}
+
+// jsonKeys lists the keys of jsonData, and whether they are required.
+var jsonKeys = map[string]bool{
+	"time":          true,
+	"co2_ppm":       true,
+	"temperature_c": true,
+	"humidity_pct":  true,
+	"pressure_hpa":  true,
+	"battery_pct":   true,
+	"quality":       true,
+	"interval_s":    true,
+	"model":         false,
+}
+
+// legacyJSONData is the JSON representation of Data before jsonData was
+// introduced, i.e. the default encoding of its fields:
+//
+//	{"H":40,"P":1013.2,"T":21.5,"CO2":800,"Battery":90,"Quality":1,
+//	 "Interval":300000000000,"Time":"2006-01-02T15:04:05Z"}
+//
+// Quality may also be encoded as a string and Interval is in nanoseconds.
+type legacyJSONData struct {
+	H, P, T  float64
+	CO2      int
+	Battery  int
+	Quality  json.RawMessage
+	Interval time.Duration
+	Time     time.Time
+}
+
+// legacyJSONKeys lists the keys of legacyJSONData, all of them required.
+var legacyJSONKeys = map[string]bool{
+	"H": true, "P": true, "T": true, "CO2": true, "Battery": true,
+	"Quality": true, "Interval": true, "Time": true,
+}
+
+// MarshalJSON implements json.Marshaler.
+// Time-stamps are encoded as RFC3339 strings.
+func (data Data) MarshalJSON() ([]byte, error) {
+	return data.marshalJSON(TimeRFC3339)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+// Time-stamps may be RFC3339 strings or seconds since the Unix epoch.
+//
+// UnmarshalJSON also decodes the legacy representation of Data, using
+// the Go field names as keys.
+// Objects missing a required key are rejected, while unknown keys are
+// ignored so that fields added later do not break older decoders.
+func (data *Data) UnmarshalJSON(p []byte) error {
+	return data.unmarshalJSON(p, TimeRFC3339)
+}
+
+func (data Data) marshalJSON(tf TimeFormat) ([]byte, error) {
+	raw, err := marshalTime(data.Time, tf)
+	if err != nil {
+		return nil, err
+	}
+	v := jsonData{
+		Time:     raw,
+		H:        data.H,
+		Battery:  data.Battery,
+		Interval: data.Interval.Seconds(),
+		Model:    data.Model,
+	}
+	if data.CO2 != -1 {
+		v.CO2 = &data.CO2
+		v.Quality = &data.Quality
+	}
+	if !math.IsNaN(data.T) {
+		v.T = &data.T
+	}
+	if data.P != -1 {
+		v.P = &data.P
+	}
+	return json.Marshal(v)
+}
+
+func (data *Data) unmarshalJSON(p []byte, tf TimeFormat) error {
+	if bytes.Equal(bytes.TrimSpace(p), []byte("null")) {
+		return nil
+	}
+
+	var keys map[string]json.RawMessage
+	err := json.Unmarshal(p, &keys)
+	if err != nil {
+		return err
+	}
+	for k := range keys {
+		if legacyJSONKeys[k] {
+			err = checkRequiredJSONKeys(keys, legacyJSONKeys)
+			if err != nil {
+				return err
+			}
+			return data.unmarshalLegacyJSON(p)
+		}
+	}
+	err = checkRequiredJSONKeys(keys, jsonKeys)
+	if err != nil {
+		return err
+	}
+
+	var raw jsonData
+	err = json.Unmarshal(p, &raw)
+	if err != nil {
+		return err
+	}
+	t, err := unmarshalTime(raw.Time, tf)
+	if err != nil {
+		return err
+	}
+	*data = Data{
+		H:        raw.H,
+		P:        -1,
+		T:        math.NaN(),
+		CO2:      -1,
+		Battery:  raw.Battery,
+		Interval: time.Duration(raw.Interval * float64(time.Second)),
+		Model:    raw.Model,
+		Time:     t,
+	}
+	if raw.CO2 != nil {
+		data.CO2 = *raw.CO2
+	}
+	if raw.T != nil {
+		data.T = *raw.T
+	}
+	if raw.P != nil {
+		data.P = *raw.P
+	}
+	if raw.Quality != nil {
+		data.Quality = *raw.Quality
+	}
+	return nil
+}
+
+func (data *Data) unmarshalLegacyJSON(p []byte) error {
+	var raw legacyJSONData
+	err := json.Unmarshal(p, &raw)
+	if err != nil {
+		return err
+	}
+
+	var q Quality
+	switch {
+	case len(raw.Quality) > 0 && raw.Quality[0] == '"':
+		err = json.Unmarshal(raw.Quality, &q)
+	default:
+		err = q.UnmarshalText(raw.Quality)
+	}
+	if err != nil {
+		return err
+	}
+
+	*data = Data{
+		H:        raw.H,
+		P:        raw.P,
+		T:        raw.T,
+		CO2:      raw.CO2,
+		Battery:  raw.Battery,
+		Quality:  q,
+		Interval: raw.Interval,
+		Time:     raw.Time,
+	}
+	return nil
+}
+
+// checkRequiredJSONKeys checks keys holds all the required keys of
+// schema.
+func checkRequiredJSONKeys(keys map[string]json.RawMessage, schema map[string]bool) error {
+	for k, required := range schema {
+		if _, ok := keys[k]; required && !ok {
+			return fmt.Errorf("aranet4: missing JSON key %q", k)
+		}
+	}
+	return nil
+}
+
+// JSONData wraps a Data value so its time-stamp is encoded in JSON
+// according to Format.
+//
+// Decoding accepts both RFC3339 strings and numeric time-stamps,
+// numbers being interpreted according to Format (seconds unless
+// Format is TimeUnixMilli).
+type JSONData struct {
+	Data
+	Format TimeFormat
+}
+
+func (v JSONData) MarshalJSON() ([]byte, error) {
+	return v.Data.marshalJSON(v.Format)
+}
+
+func (v *JSONData) UnmarshalJSON(p []byte) error {
+	return v.Data.unmarshalJSON(p, v.Format)
+}
+
+func marshalTime(t time.Time, tf TimeFormat) ([]byte, error) {
+	switch tf {
+	case TimeRFC3339:
+		return json.Marshal(t)
+	case TimeUnix:
+		return strconv.AppendInt(nil, t.Unix(), 10), nil
+	case TimeUnixMilli:
+		return strconv.AppendInt(nil, t.UnixMilli(), 10), nil
+	default:
+		return nil, fmt.Errorf("aranet4: invalid time format %v", tf)
+	}
+}
+
+func unmarshalTime(p []byte, tf TimeFormat) (time.Time, error) {
+	var t time.Time
+	switch {
+	case len(p) == 0, bytes.Equal(p, []byte("null")):
+		return t, nil
+	case p[0] == '"':
+		err := json.Unmarshal(p, &t)
+		return t, err
+	}
+
+	v, err := strconv.ParseInt(string(p), 10, 64)
+	if err != nil {
+		return t, fmt.Errorf("aranet4: invalid time-stamp %q: %w", p, err)
+	}
+	switch tf {
+	case TimeUnixMilli:
+		return time.UnixMilli(v).UTC(), nil
+	default:
+		return time.Unix(v, 0).UTC(), nil
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright ©2023 The aranet4 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package aranet4
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// testSample returns a plausible Aranet4 sample.
+func testSample() Data {
+	return Data{
+		H:        41,
+		P:        1013.2,
+		T:        21.35,
+		CO2:      812,
+		Battery:  87,
+		Quality:  1,
+		Interval: 5 * time.Minute,
+		Time:     time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+}
+
+// assertGolden compares got with the content of the golden file name,
+// updating the file instead when the -update flag is set.
+func assertGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	fname := filepath.Join("testdata", name)
+	if *update {
+		err := os.WriteFile(fname, got, 0644)
+		if err != nil {
+			t.Fatalf("could not update golden file: %+v", err)
+		}
+	}
+	want, err := os.ReadFile(fname)
+	if err != nil {
+		t.Fatalf("could not read golden file: %+v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("output does not match %s:\ngot:\n%s\nwant:\n%s", fname, got, want)
+	}
+}
+
+func TestMarshalJSONGolden(t *testing.T) {
+	v := testSample()
+	vs := []any{
+		v,
+		JSONData{Data: v, Format: TimeUnix},
+		JSONData{Data: v, Format: TimeUnixMilli},
+		testSampleAranet2(),
+		testSampleGap(),
+	}
+	got, err := json.MarshalIndent(vs, "", "  ")
+	if err != nil {
+		t.Fatalf("could not marshal data: %+v", err)
+	}
+	assertGolden(t, "data.json", append(got, '\n'))
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	for _, tf := range []TimeFormat{TimeRFC3339, TimeUnix, TimeUnixMilli} {
+		for _, want := range []Data{testSample(), testSampleAranet2(), testSampleGap()} {
+			p, err := json.Marshal(JSONData{Data: want, Format: tf})
+			if err != nil {
+				t.Fatalf("%v: could not marshal data: %+v", tf, err)
+			}
+			got := JSONData{Format: tf}
+			err = json.Unmarshal(p, &got)
+			if err != nil {
+				t.Fatalf("%v: could not unmarshal data: %+v", tf, err)
+			}
+			if !got.Data.Time.Equal(want.Time) {
+				t.Fatalf("%v: invalid time: got=%v, want=%v", tf, got.Data.Time, want.Time)
+			}
+			got.Data.Time = want.Time
+			if !sameData(got.Data, want) {
+				t.Fatalf("%v: invalid round-trip:\ngot= %+v\nwant=%+v", tf, got.Data, want)
+			}
+		}
+	}
+}
+
+func TestUnmarshalJSONLegacy(t *testing.T) {
+	want := testSample()
+	for _, p := range []string{
+		`{"H":41,"P":1013.2,"T":21.35,"CO2":812,"Battery":87,"Quality":1,"Interval":300000000000,"Time":"2023-01-02T03:04:05Z"}`,
+		`{"H":41,"P":1013.2,"T":21.35,"CO2":812,"Battery":87,"Quality":"green","Interval":300000000000,"Time":"2023-01-02T03:04:05Z"}`,
+	} {
+		var got Data
+		err := json.Unmarshal([]byte(p), &got)
+		if err != nil {
+			t.Fatalf("could not unmarshal legacy data %s: %+v", p, err)
+		}
+		if got != want {
+			t.Fatalf("invalid legacy data:\ngot= %+v\nwant=%+v", got, want)
+		}
+	}
+}
+
+func TestUnmarshalJSONUnknownKeys(t *testing.T) {
+	want := testSample()
+	for _, p := range []string{
+		`{"time":"2023-01-02T03:04:05Z","co2_ppm":812,"temperature_c":21.35,"humidity_pct":41,"pressure_hpa":1013.2,"battery_pct":87,"quality":"green","interval_s":300,"voc_ppb":3}`,
+		`{"H":41,"P":1013.2,"T":21.35,"CO2":812,"Battery":87,"Quality":1,"Interval":300000000000,"Time":"2023-01-02T03:04:05Z","Model":0}`,
+	} {
+		var got Data
+		err := json.Unmarshal([]byte(p), &got)
+		if err != nil {
+			t.Fatalf("could not unmarshal data with unknown keys %s: %+v", p, err)
+		}
+		if got != want {
+			t.Fatalf("invalid data:\ngot= %+v\nwant=%+v", got, want)
+		}
+	}
+}
+
+func TestUnmarshalJSONInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		json string
+		want string
+	}{
+		{
+			name: "missing-key",
+			json: `{"time":"2023-01-02T03:04:05Z","temperature_c":21.35,"humidity_pct":41,"pressure_hpa":1013.2,"battery_pct":87,"quality":"green","interval_s":300}`,
+			want: `missing JSON key "co2_ppm"`,
+		},
+		{
+			name: "legacy-missing-key",
+			json: `{"H":41,"P":1013.2,"T":21.35,"CO2":812,"Battery":87,"Quality":1,"Time":"2023-01-02T03:04:05Z"}`,
+			want: `missing JSON key "Interval"`,
+		},
+		{
+			name: "mixed-keys",
+			json: `{"CO2":812,"temperature_c":21.35}`,
+			want: `missing JSON key`,
+		},
+		{
+			name: "not-an-object",
+			json: `[1,2,3]`,
+			want: "cannot unmarshal",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var v Data
+			err := json.Unmarshal([]byte(tc.json), &v)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("invalid error: got=%v, want=%q", err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright ©2023 The aranet4 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package aranet4
+
+import (
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/rigado/ble"
+)
+
+const (
+	defaultRetries  = 2
+	defaultAttempts = 5
+	defaultBackoff  = 1 * time.Second
+
+	defaultScanTimeout    = 15 * time.Second
+	defaultConnectTimeout = 15 * time.Second
+)
+
+// AddressType is the type of a Bluetooth LE device address.
+type AddressType int
+
+const (
+	AddressAny    AddressType = iota // match any address type
+	AddressPublic                    // public device address
+	AddressRandom                    // random device address
+)
+
+// Option configures a Device or a ReliableDevice.
+type Option func(*config)
+
+type config struct {
+	retries  int  // number of retries for a failed history parameter
+	validate bool // whether to validate samples read from the device
+
+	device         ble.Device    // BLE adapter used to connect, nil for the default one
+	scanTimeout    time.Duration // maximum time to find the device
+	connectTimeout time.Duration // maximum time to connect to the found device
+	addrType       AddressType   // address type of the device
+
+	attempts int           // number of connection attempts of a ReliableDevice
+	backoff  time.Duration // initial delay between attempts of a ReliableDevice
+
+	logger *slog.Logger // logger of the device, nil for the package logger
+	hook   ReadHook     // read instrumentation, nil if disabled
+}
+
+// log returns the logger of the device.
+func (cfg config) log() *slog.Logger {
+	if cfg.logger != nil {
+		return cfg.logger
+	}
+	return logger()
+}
+
+func newConfig(opts []Option) config {
+	cfg := config{
+		retries:  defaultRetries,
+		attempts: defaultAttempts,
+		backoff:  defaultBackoff,
+
+		scanTimeout:    defaultScanTimeout,
+		connectTimeout: defaultConnectTimeout,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// WithRetries sets how many times ReadAll re-downloads the history of
+// a single parameter (temperature, humidity, pressure or CO2) after a
+// failure, before giving up.
+// Parameters already downloaded are kept across retries.
+func WithRetries(n int) Option {
+	return func(cfg *config) {
+		cfg.retries = max(n, 0)
+	}
+}
+
+// WithReconnect sets how many times a ReliableDevice attempts an
+// operation, reconnecting to the device between attempts.
+// The delay between attempts starts at backoff and doubles after each
+// failed attempt.
+func WithReconnect(attempts int, backoff time.Duration) Option {
+	return func(cfg *config) {
+		cfg.attempts = max(attempts, 1)
+		cfg.backoff = backoff
+	}
+}
+
+// WithValidation makes Read reject samples that fail Data.Validate.
+func WithValidation() Option {
+	return func(cfg *config) {
+		cfg.validate = true
+	}
+}
+
+// WithDevice makes New connect through the provided BLE adapter (e.g. a
+// specific HCI device) instead of the default one set with
+// ble.SetDefaultDevice.
+// This allows dedicating an adapter to a sensor on hosts with several
+// Bluetooth dongles.
+func WithDevice(d ble.Device) Option {
+	return func(cfg *config) {
+		cfg.device = d
+	}
+}
+
+// WithScanTimeout sets how long New scans for the device before giving
+// up. The default is 15 seconds.
+func WithScanTimeout(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.scanTimeout = d
+	}
+}
+
+// WithConnectTimeout sets how long New waits for the connection to a
+// found device to be established. The default is 15 seconds.
+func WithConnectTimeout(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.connectTimeout = d
+	}
+}
+
+// WithAddressType restricts New to devices advertising with the given
+// address type. By default, any address type is accepted.
+func WithAddressType(t AddressType) Option {
+	return func(cfg *config) {
+		cfg.addrType = t
+	}
+}
+
+// WithLogger makes the device log through l instead of the package
+// logger set with SetLogger.
+// A nil logger silences the device.
+func WithLogger(l *slog.Logger) Option {
+	return func(cfg *config) {
+		if l == nil {
+			l = slog.New(slog.NewTextHandler(io.Discard, nil))
+		}
+		cfg.logger = l
+	}
+}
+
+// Operations reported to a ReadHook.
+const (
+	OpRead        = "read"         // read of a single characteristic
+	OpReadHistory = "read_history" // download of the history of a parameter
+)
+
+// ReadHook is called after each BLE read operation with the name of the
+// operation (OpRead or OpReadHistory), its duration and its error, if any.
+type ReadHook func(op string, d time.Duration, err error)
+
+// WithReadHook makes the device report the duration of its BLE reads to
+// fn, e.g. to feed a latency histogram.
+// fn is called synchronously and should return quickly.
+// Reads are not timed when no hook is set.
+func WithReadHook(fn ReadHook) Option {
+	return func(cfg *config) {
+		cfg.hook = fn
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright ©2023 The aranet4 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package aranet4
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rigado/ble/linux/att"
+)
+
+// Sensor is the interface implemented by Device and ReliableDevice, letting
+// applications switch between a plain connection and a reconnecting one.
+type Sensor interface {
+	// Read reads the current data sample.
+	Read() (Data, error)
+	// ReadContext is like Read but gives up when ctx is done.
+	ReadContext(ctx context.Context) (Data, error)
+
+	// ReadAll reads the whole history stored on the device.
+	ReadAll() ([]Data, error)
+	// ReadAllContext is like ReadAll but gives up when ctx is done.
+	ReadAllContext(ctx context.Context) ([]Data, error)
+
+	// Interval returns the measurement interval of the device.
+	Interval() (time.Duration, error)
+	// IntervalContext is like Interval but gives up when ctx is done.
+	IntervalContext(ctx context.Context) (time.Duration, error)
+
+	// Close closes the connection to the device.
+	Close() error
+}
+
+var (
+	_ Sensor = (*Device)(nil)
+	_ Sensor = (*ReliableDevice)(nil)
+)
+
+// ReliableDevice is an Aranet4 client that transparently (re)connects to
+// the device on demand, so callers never hold a dead connection.
+//
+// ReliableDevice is safe for concurrent use.
+type ReliableDevice struct {
+	addr string
+	cfg  config
+
+	mu  sync.Mutex
+	dev *Device
+}
+
+// NewReliable returns a ReliableDevice for the device at addr.
+// No connection is made until one of its methods is called.
+func NewReliable(addr string, opts ...Option) *ReliableDevice {
+	return &ReliableDevice{
+		addr: addr,
+		cfg:  newConfig(opts),
+	}
+}
+
+// Read reads the current data sample from the device.
+func (rd *ReliableDevice) Read() (Data, error) {
+	return rd.ReadContext(context.Background())
+}
+
+// ReadContext is like Read but gives up when ctx is done.
+func (rd *ReliableDevice) ReadContext(ctx context.Context) (Data, error) {
+	var data Data
+	err := rd.do(ctx, func(dev *Device) error {
+		var err error
+		data, err = dev.ReadContext(ctx)
+		return err
+	})
+	return data, err
+}
+
+// ReadAll reads the whole history from the device.
+func (rd *ReliableDevice) ReadAll() ([]Data, error) {
+	return rd.ReadAllContext(context.Background())
+}
+
+// ReadAllContext is like ReadAll but gives up when ctx is done.
+func (rd *ReliableDevice) ReadAllContext(ctx context.Context) ([]Data, error) {
+	var data []Data
+	err := rd.do(ctx, func(dev *Device) error {
+		var err error
+		data, err = dev.ReadAllContext(ctx)
+		return err
+	})
+	return data, err
+}
+
+// Interval returns the measurement interval of the device.
+func (rd *ReliableDevice) Interval() (time.Duration, error) {
+	return rd.IntervalContext(context.Background())
+}
+
+// IntervalContext is like Interval but gives up when ctx is done.
+func (rd *ReliableDevice) IntervalContext(ctx context.Context) (time.Duration, error) {
+	var v time.Duration
+	err := rd.do(ctx, func(dev *Device) error {
+		var err error
+		v, err = dev.IntervalContext(ctx)
+		return err
+	})
+	return v, err
+}
+
+// Close closes the underlying connection, if any.
+// A later call to one of the methods of rd will reconnect.
+func (rd *ReliableDevice) Close() error {
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+
+	if rd.dev == nil {
+		return nil
+	}
+	err := rd.dev.Close()
+	rd.dev = nil
+	return err
+}
+
+// do runs fn against a connected device, reconnecting and retrying with
+// an exponential backoff when fn or the connection fails.
+func (rd *ReliableDevice) do(ctx context.Context, fn func(dev *Device) error) error {
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+
+	err := retry(ctx, rd.cfg.log().With("addr", rd.addr), rd.cfg.attempts, rd.cfg.backoff, func(int) error {
+		err := rd.connect(ctx)
+		if err != nil {
+			return fmt.Errorf("could not connect: %w", err)
+		}
+
+		err = fn(rd.dev)
+		if err != nil && isTransient(err) {
+			// drop the connection: it will be re-established on the next attempt.
+			_ = rd.dev.Close()
+			rd.dev = nil
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("aranet4: device %q: %w", rd.addr, err)
+	}
+	return nil
+}
+
+// connect makes sure rd holds a live connection to the device.
+func (rd *ReliableDevice) connect(ctx context.Context) error {
+	if rd.dev != nil {
+		if rd.dev.alive() {
+			return nil
+		}
+		rd.dev = nil
+	}
+
+	dev, err := dialDevice(ctx, rd.addr, rd.cfg)
+	if err != nil {
+		return err
+	}
+	rd.dev = dev
+	return nil
+}
+
+// retry calls fn until it succeeds, fails with a permanent error or ctx is
+// done, making at most attempts calls (and at least one).
+// fn receives the index of the attempt, starting at 0.
+// The delay between attempts starts at backoff and doubles after each
+// failed attempt.
+func retry(ctx context.Context, log *slog.Logger, attempts int, backoff time.Duration, fn func(attempt int) error) error {
+	attempts = max(attempts, 1)
+
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			if err := sleepContext(ctx, backoff); err != nil {
+				return err
+			}
+			backoff *= 2
+		}
+
+		err = fn(i)
+		if err == nil || ctx.Err() != nil || !isTransient(err) {
+			return err
+		}
+		log.Warn("attempt failed", "attempt", i+1, "attempts", attempts, "err", err)
+	}
+	return fmt.Errorf("failed after %d attempts: %w", attempts, err)
+}
+
+// isTransient reports whether err may go away after reconnecting to
+// the device, i.e. whether it signals a lost connection or a timeout.
+// Other errors, such as unsupported operations or invalid data, are
+// permanent.
+func isTransient(err error) bool {
+	var timeout interface{ Timeout() bool }
+	switch {
+	case errors.Is(err, ErrClosed),
+		errors.Is(err, ErrConnectTimeout),
+		errors.Is(err, io.ErrClosedPipe),
+		errors.Is(err, att.ErrSeqProtoTimeout),
+		errors.Is(err, os.ErrDeadlineExceeded):
+		return true
+	case errors.As(err, &timeout):
+		return timeout.Timeout()
+	default:
+		return false
+	}
+}
+
+// sleepContext waits for d, or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
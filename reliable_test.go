@@ -0,0 +1,214 @@
+// Copyright ©2023 The aranet4 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package aranet4
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+// fakeDialer returns a dial function connecting, in turn, to the devices
+// backed by fs, and failing with ErrConnectTimeout when none is left.
+func fakeDialer(fs ...*fakeClient) (dial func(ctx context.Context, addr string, cfg config) (*Device, error), dials *int) {
+	dials = new(int)
+	dial = func(ctx context.Context, addr string, cfg config) (*Device, error) {
+		*dials++
+		if len(fs) == 0 {
+			return nil, fmt.Errorf("could not connect to device %q: %w", addr, ErrConnectTimeout)
+		}
+		f := fs[0]
+		fs = fs[1:]
+		dev := newFakeDevice(f)
+		dev.cfg = cfg
+		return dev, nil
+	}
+	return dial, dials
+}
+
+func TestReliableDeviceDrop(t *testing.T) {
+	f1 := newFakeClient()
+	f1.chars[uuidReadAll] = encodeReadAll(Data{CO2: 500}, 0)
+	f2 := newFakeClient()
+	f2.chars[uuidReadAll] = encodeReadAll(Data{CO2: 600}, 0)
+
+	dial, dials := fakeDialer(f1, f2)
+	setDial(t, dial)
+	rd := NewReliable("F5:6C:BE:D5:61:47", WithReconnect(3, time.Millisecond))
+	defer rd.Close()
+
+	got, err := rd.Read()
+	if err != nil {
+		t.Fatalf("could not read sample: %+v", err)
+	}
+	if got.CO2 != 500 || *dials != 1 {
+		t.Fatalf("invalid first read: CO2=%d, dials=%d", got.CO2, *dials)
+	}
+
+	// the link drops between two reads.
+	_ = f1.CancelConnection()
+
+	got, err = rd.Read()
+	if err != nil {
+		t.Fatalf("could not read sample after drop: %+v", err)
+	}
+	if got.CO2 != 600 || *dials != 2 {
+		t.Fatalf("invalid read after drop: CO2=%d, dials=%d", got.CO2, *dials)
+	}
+}
+
+func TestReliableDeviceDropMidRead(t *testing.T) {
+	f1 := newFakeClient()
+	f1.block[uuidReadAll] = true
+	f2 := newFakeClient()
+	f2.chars[uuidReadAll] = encodeReadAll(Data{CO2: 600}, 0)
+
+	dial, dials := fakeDialer(f1, f2)
+	setDial(t, dial)
+	rd := NewReliable("F5:6C:BE:D5:61:47", WithReconnect(3, time.Millisecond))
+	defer rd.Close()
+
+	// the link drops while the read is in-flight.
+	time.AfterFunc(10*time.Millisecond, func() { _ = f1.CancelConnection() })
+
+	got, err := rd.Read()
+	if err != nil {
+		t.Fatalf("could not read sample: %+v", err)
+	}
+	if got.CO2 != 600 || *dials != 2 {
+		t.Fatalf("invalid read after drop: CO2=%d, dials=%d", got.CO2, *dials)
+	}
+}
+
+func TestReliableDeviceDropMidHistory(t *testing.T) {
+	vs := testHistory(10)
+
+	f1 := newFakeClient()
+	f1.setHistory(vs, time.Minute, 0, 2)
+	f1.notify = func(cmd []byte) [][]byte {
+		notes := historyNotifications(vs, cmd, 2)
+		if cmd[1] != paramCO2 {
+			return notes
+		}
+		// the link drops in the middle of the CO2 pass.
+		go func() { _ = f1.CancelConnection() }()
+		return notes[:2]
+	}
+	f2 := newFakeClient()
+	f2.setHistory(vs, time.Minute, 0, 2)
+
+	dial, dials := fakeDialer(f1, f2)
+	setDial(t, dial)
+	rd := NewReliable("F5:6C:BE:D5:61:47", WithReconnect(3, time.Millisecond))
+	defer rd.Close()
+
+	got, err := rd.ReadAll()
+	if err != nil {
+		t.Fatalf("could not read history: %+v", err)
+	}
+	if *dials != 2 {
+		t.Fatalf("invalid number of connections: got=%d, want=2", *dials)
+	}
+	assertHistory(t, got, vs, time.Minute, 0)
+}
+
+func TestReliableDevicePermanent(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		set  func(f *fakeClient)
+		opts []Option
+		want error
+	}{
+		{
+			name: "invalid-data",
+			set: func(f *fakeClient) {
+				f.chars[uuidReadAll] = encodeReadAll(Data{CO2: 500, P: 100}, 0)
+			},
+			opts: []Option{WithValidation()},
+			want: ErrInvalidData,
+		},
+		{
+			name: "short-payload",
+			set:  func(f *fakeClient) { f.chars[uuidReadAll] = []byte{1} },
+			want: io.ErrUnexpectedEOF,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newFakeClient()
+			tc.set(f)
+			dial, dials := fakeDialer(f, newFakeClient())
+			setDial(t, dial)
+			opts := append([]Option{WithReconnect(3, time.Hour)}, tc.opts...)
+			rd := NewReliable("F5:6C:BE:D5:61:47", opts...)
+			defer rd.Close()
+
+			_, err := rd.Read()
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("invalid error: got=%+v, want=%v", err, tc.want)
+			}
+			if *dials != 1 {
+				t.Fatalf("permanent error retried: dials=%d", *dials)
+			}
+		})
+	}
+}
+
+func TestReliableDeviceUnsupported(t *testing.T) {
+	dial, dials := fakeDialer(newFakeClient(), newFakeClient())
+	setDial(t, func(ctx context.Context, addr string, cfg config) (*Device, error) {
+		dev, err := dial(ctx, addr, cfg)
+		if dev != nil {
+			dev.model = Aranet2
+		}
+		return dev, err
+	})
+	rd := NewReliable("F5:6C:BE:D5:61:47", WithReconnect(3, time.Hour))
+	defer rd.Close()
+
+	_, err := rd.ReadAll()
+	if !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("invalid error: got=%+v, want=%v", err, errors.ErrUnsupported)
+	}
+	if *dials != 1 {
+		t.Fatalf("permanent error retried: dials=%d", *dials)
+	}
+}
+
+func TestReliableDeviceAttempts(t *testing.T) {
+	dial, dials := fakeDialer()
+	setDial(t, dial)
+	rd := NewReliable("F5:6C:BE:D5:61:47", WithReconnect(3, time.Millisecond))
+
+	_, err := rd.Read()
+	if !errors.Is(err, ErrConnectTimeout) {
+		t.Fatalf("invalid error: got=%+v, want=%v", err, ErrConnectTimeout)
+	}
+	if *dials != 3 {
+		t.Fatalf("invalid number of attempts: got=%d, want=3", *dials)
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{fmt.Errorf("device disconnected: %w", ErrClosed), true},
+		{fmt.Errorf("could not connect: %w", ErrConnectTimeout), true},
+		{fmt.Errorf("send ATT request failed: %w", io.ErrClosedPipe), true},
+		{ErrDeviceNotFound, false},
+		{ErrInvalidData, false},
+		{errors.ErrUnsupported, false},
+		{fmt.Errorf("aranet4: invalid range [8, 11) (device holds 10 samples)"), false},
+		{io.ErrUnexpectedEOF, false},
+	} {
+		if got := isTransient(tc.err); got != tc.want {
+			t.Errorf("isTransient(%v): got=%v, want=%v", tc.err, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright ©2023 The aranet4 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package aranet4
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rigado/ble"
+)
+
+// manufacturerID is the Bluetooth SIG company identifier of SAF Tehnika,
+// the maker of Aranet devices.
+const manufacturerID = 0x0702
+
+// aranet4Services lists the service UUIDs advertised by Aranet4 devices.
+var aranet4Services = []ble.UUID{
+	ble.MustParse(uuidDeviceService),
+	ble.MustParse(uuidDeviceServiceV1_2_0),
+	ble.UUID16(0xfce0), // short form of uuidDeviceServiceV1_2_0
+}
+
+// Advertisement describes an Aranet4 device discovered by Scan.
+type Advertisement struct {
+	Addr string // MAC address of the device
+	Name string // advertised name of the device, if any
+	RSSI int    // received signal strength, in dBm
+}
+
+// Scan listens for Aranet4 advertisements for the duration d, or until
+// ctx is done, and returns the discovered devices, deduplicated by
+// MAC address and in discovery order.
+func Scan(ctx context.Context, d time.Duration) ([]Advertisement, error) {
+	sctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+
+	var (
+		mu   sync.Mutex
+		advs []Advertisement
+		seen = make(map[string]int)
+	)
+	handler := func(a ble.Advertisement) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		addr := strings.ToUpper(a.Addr().String())
+		if i, ok := seen[addr]; ok {
+			// the name may only be present in the scan response.
+			if advs[i].Name == "" {
+				advs[i].Name = a.LocalName()
+			}
+			advs[i].RSSI = a.RSSI()
+			return
+		}
+		seen[addr] = len(advs)
+		advs = append(advs, Advertisement{
+			Addr: addr,
+			Name: a.LocalName(),
+			RSSI: a.RSSI(),
+		})
+	}
+
+	err := ble.Scan(ble.WithSigHandler(sctx, cancel), false, handler, isAranet4)
+	switch {
+	case ctx.Err() != nil:
+		return nil, ctx.Err()
+	case err != nil && !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, context.Canceled):
+		return nil, fmt.Errorf("could not scan for devices: %w", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	return advs, nil
+}
+
+// isAranet4 reports whether the advertisement was sent by an Aranet4.
+func isAranet4(a ble.Advertisement) bool {
+	if strings.HasPrefix(a.LocalName(), "Aranet4") {
+		return true
+	}
+	for _, svc := range a.Services() {
+		if ble.Contains(aranet4Services, svc) {
+			return true
+		}
+	}
+	mfg := a.ManufacturerData()
+	return len(mfg) >= 2 && int(mfg[0])|int(mfg[1])<<8 == manufacturerID
+}
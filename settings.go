@@ -0,0 +1,238 @@
+// Copyright ©2023 The aranet4 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package aranet4
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Layout of the uuidReadSensorState characteristic:
+//
+//	[0]     device type
+//	[1]     configuration flags; bit 0 is set when the buzzer is enabled
+//	[2]     status flags; bits 2-3 hold the CalibrationState, as in
+//	        the flags of the advertisement
+//	[3:5]   CO2 yellow threshold, in ppm (uint16, little-endian)
+//	[5:7]   CO2 red threshold, in ppm (uint16, little-endian)
+//
+// Firmwares without configurable thresholds only send the first 3 bytes.
+const (
+	stateConfigOffset = 1
+	stateStatusOffset = 2
+	stateYellowOffset = 3
+	stateRedOffset    = 5
+	stateMinSize      = 3
+	stateSize         = 7
+
+	stateConfigBuzzer = 1 << 0
+
+	stateCalibShift = 2
+	stateCalibMask  = 0b11
+)
+
+// CalibrationState describes the progress of the CO2 sensor calibration.
+type CalibrationState int
+
+const (
+	CalibrationIdle       CalibrationState = iota // no calibration in progress
+	CalibrationEndRequest                         // calibration is being finalized
+	CalibrationInProgress                         // calibration is running
+	CalibrationError                              // last calibration failed
+)
+
+func (cs CalibrationState) String() string {
+	switch cs {
+	case CalibrationIdle:
+		return "idle"
+	case CalibrationEndRequest:
+		return "end-request"
+	case CalibrationInProgress:
+		return "in-progress"
+	case CalibrationError:
+		return "error"
+	default:
+		return fmt.Sprintf("CalibrationState(%d)", int(cs))
+	}
+}
+
+// CalibrationState returns the state of the CO2 sensor calibration.
+// It is only supported by Aranet4 devices.
+func (dev *Device) CalibrationState() (CalibrationState, error) {
+	return dev.CalibrationStateContext(context.Background())
+}
+
+// CalibrationStateContext is like CalibrationState but gives up when ctx
+// is done.
+func (dev *Device) CalibrationStateContext(ctx context.Context) (CalibrationState, error) {
+	if dev.model != Aranet4 {
+		return 0, fmt.Errorf("aranet4: calibration not supported for %v devices: %w", dev.model, errors.ErrUnsupported)
+	}
+
+	raw, err := dev.readSensorState(ctx)
+	if err != nil {
+		return 0, err
+	}
+	st := raw[stateStatusOffset] >> stateCalibShift & stateCalibMask
+	return CalibrationState(st), nil
+}
+
+// Calibrate requests a manual calibration of the CO2 sensor, by writing
+// the command {0x95, 0x01} to the command characteristic.
+// The device should be placed outdoors, or in a well ventilated room
+// (around 400 ppm), for the whole duration of the calibration, which can
+// be followed with CalibrationState.
+//
+// Calibrate is only supported by Aranet4 devices.
+func (dev *Device) Calibrate() error {
+	return dev.CalibrateContext(context.Background())
+}
+
+// CalibrateContext is like Calibrate but gives up when ctx is done.
+func (dev *Device) CalibrateContext(ctx context.Context) error {
+	if dev.model != Aranet4 {
+		return fmt.Errorf("aranet4: calibration not supported for %v devices: %w", dev.model, errors.ErrUnsupported)
+	}
+
+	c, err := dev.devCharByUUID(uuidWriteCmd)
+	if err != nil {
+		return fmt.Errorf("could not get characteristic %q: %w", uuidWriteCmd, err)
+	}
+
+	cmd := []byte{cmdCalibrate, 0x01}
+	err = dev.write(ctx, c, cmd)
+	if err != nil {
+		return fmt.Errorf("could not write command: %w", err)
+	}
+	return nil
+}
+
+// Bounds of the CO2 alarm thresholds, in ppm.
+const (
+	minThreshold = 400
+	maxThreshold = 9999
+)
+
+// BuzzerConfig describes the CO2 alarm of an Aranet4.
+// The device beeps when the CO2 concentration crosses Red, and the
+// displayed quality turns yellow at Yellow and red at Red.
+type BuzzerConfig struct {
+	Enabled bool // whether the buzzer sounds on alarm
+	Yellow  int  // yellow threshold, in ppm
+	Red     int  // red threshold, in ppm
+}
+
+// Validate checks the thresholds are within [400, 9999] ppm and that
+// Yellow is below Red.
+func (cfg BuzzerConfig) Validate() error {
+	switch {
+	case cfg.Yellow < minThreshold || cfg.Yellow > maxThreshold:
+		return fmt.Errorf("aranet4: yellow threshold %d ppm out of range [%d, %d]", cfg.Yellow, minThreshold, maxThreshold)
+	case cfg.Red < minThreshold || cfg.Red > maxThreshold:
+		return fmt.Errorf("aranet4: red threshold %d ppm out of range [%d, %d]", cfg.Red, minThreshold, maxThreshold)
+	case cfg.Yellow >= cfg.Red:
+		return fmt.Errorf("aranet4: yellow threshold %d ppm not below red threshold %d ppm", cfg.Yellow, cfg.Red)
+	}
+	return nil
+}
+
+// BuzzerConfig returns the CO2 alarm configuration of the device.
+// It returns an error wrapping errors.ErrUnsupported for models other
+// than Aranet4 and for firmwares without configurable thresholds.
+func (dev *Device) BuzzerConfig() (BuzzerConfig, error) {
+	return dev.BuzzerConfigContext(context.Background())
+}
+
+// BuzzerConfigContext is like BuzzerConfig but gives up when ctx is done.
+func (dev *Device) BuzzerConfigContext(ctx context.Context) (BuzzerConfig, error) {
+	if dev.model != Aranet4 {
+		return BuzzerConfig{}, fmt.Errorf("aranet4: buzzer not supported for %v devices: %w", dev.model, errors.ErrUnsupported)
+	}
+
+	raw, err := dev.readSensorState(ctx)
+	if err != nil {
+		return BuzzerConfig{}, err
+	}
+	if len(raw) < stateSize {
+		return BuzzerConfig{}, fmt.Errorf("aranet4: CO2 thresholds not supported by firmware: %w", errors.ErrUnsupported)
+	}
+
+	return BuzzerConfig{
+		Enabled: raw[stateConfigOffset]&stateConfigBuzzer != 0,
+		Yellow:  int(binary.LittleEndian.Uint16(raw[stateYellowOffset:])),
+		Red:     int(binary.LittleEndian.Uint16(raw[stateRedOffset:])),
+	}, nil
+}
+
+// SetBuzzerConfig changes the CO2 alarm configuration of the device,
+// with the commands, in this order:
+//
+//	{0x96, yellow(2), red(2)}  set the thresholds, in ppm (little-endian)
+//	{0x94, enabled}            enable (1) or disable (0) the buzzer
+//
+// The thresholds are validated with BuzzerConfig.Validate, and the
+// firmware is checked for support before anything is written.
+// If the second command fails, the new thresholds are applied but the
+// buzzer is left as it was.
+func (dev *Device) SetBuzzerConfig(cfg BuzzerConfig) error {
+	return dev.SetBuzzerConfigContext(context.Background(), cfg)
+}
+
+// SetBuzzerConfigContext is like SetBuzzerConfig but gives up when ctx
+// is done.
+func (dev *Device) SetBuzzerConfigContext(ctx context.Context, cfg BuzzerConfig) error {
+	err := cfg.Validate()
+	if err != nil {
+		return err
+	}
+
+	// check the model and firmware support.
+	_, err = dev.BuzzerConfigContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	c, err := dev.devCharByUUID(uuidWriteCmd)
+	if err != nil {
+		return fmt.Errorf("could not get characteristic %q: %w", uuidWriteCmd, err)
+	}
+
+	cmd := []byte{cmdSetThresholds, 0x00, 0x00, 0x00, 0x00}
+	binary.LittleEndian.PutUint16(cmd[1:], uint16(cfg.Yellow))
+	binary.LittleEndian.PutUint16(cmd[3:], uint16(cfg.Red))
+	err = dev.write(ctx, c, cmd)
+	if err != nil {
+		return fmt.Errorf("could not write thresholds command: %w", err)
+	}
+
+	cmd = []byte{cmdSetBuzzer, 0x00}
+	if cfg.Enabled {
+		cmd[1] = 0x01
+	}
+	err = dev.write(ctx, c, cmd)
+	if err != nil {
+		return fmt.Errorf("could not write buzzer command: %w", err)
+	}
+	return nil
+}
+
+// readSensorState reads the uuidReadSensorState characteristic.
+func (dev *Device) readSensorState(ctx context.Context) ([]byte, error) {
+	c, err := dev.devCharByUUID(uuidReadSensorState)
+	if err != nil {
+		return nil, fmt.Errorf("could not get characteristic %q: %w", uuidReadSensorState, err)
+	}
+
+	raw, err := dev.read(ctx, c)
+	if err != nil {
+		return nil, fmt.Errorf("could not read sensor state: %w", err)
+	}
+	if len(raw) < stateMinSize {
+		return nil, fmt.Errorf("aranet4: invalid sensor state %q: %w", raw, ErrInvalidData)
+	}
+	return raw, nil
+}
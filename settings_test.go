@@ -0,0 +1,170 @@
+// Copyright ©2023 The aranet4 Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package aranet4
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestCalibrationState(t *testing.T) {
+	for _, want := range []CalibrationState{
+		CalibrationIdle, CalibrationEndRequest, CalibrationInProgress, CalibrationError,
+	} {
+		t.Run(want.String(), func(t *testing.T) {
+			f := newFakeClient()
+			// other status bits are set, and must be ignored.
+			f.chars[uuidReadSensorState] = []byte{0xf1, 0x01, 0b1111_0011 | byte(want)<<2}
+			dev := newFakeDevice(f)
+
+			got, err := dev.CalibrationState()
+			if err != nil {
+				t.Fatalf("could not read calibration state: %+v", err)
+			}
+			if got != want {
+				t.Fatalf("invalid calibration state: got=%v, want=%v", got, want)
+			}
+		})
+	}
+}
+
+func TestCalibrationStateInvalid(t *testing.T) {
+	f := newFakeClient()
+	f.chars[uuidReadSensorState] = []byte{0xf1, 0x01}
+	dev := newFakeDevice(f)
+
+	_, err := dev.CalibrationState()
+	if !errors.Is(err, ErrInvalidData) {
+		t.Fatalf("invalid error: got=%+v, want=%v", err, ErrInvalidData)
+	}
+}
+
+func TestCalibrate(t *testing.T) {
+	f := newFakeClient()
+	dev := newFakeDevice(f)
+
+	err := dev.Calibrate()
+	if err != nil {
+		t.Fatalf("could not request calibration: %+v", err)
+	}
+	if len(f.writes) != 1 || !bytes.Equal(f.writes[0], []byte{0x95, 0x01}) {
+		t.Fatalf("invalid commands: got=%x, want=[9501]", f.writes)
+	}
+}
+
+func TestCalibrateUnsupported(t *testing.T) {
+	f := newFakeClient()
+	dev := newFakeDevice(f)
+	dev.model = Aranet2
+
+	err := dev.Calibrate()
+	if !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("invalid error: got=%+v, want=%v", err, errors.ErrUnsupported)
+	}
+	if len(f.writes) != 0 {
+		t.Fatalf("calibration command sent to an Aranet2: %x", f.writes)
+	}
+}
+
+func TestBuzzerConfig(t *testing.T) {
+	f := newFakeClient()
+	f.chars[uuidReadSensorState] = []byte{
+		0xf1,       // device type
+		0x01,       // buzzer enabled
+		0x00,       // status
+		0xe8, 0x03, // yellow: 1000 ppm
+		0x78, 0x05, // red: 1400 ppm
+	}
+	dev := newFakeDevice(f)
+
+	got, err := dev.BuzzerConfig()
+	if err != nil {
+		t.Fatalf("could not read buzzer config: %+v", err)
+	}
+	want := BuzzerConfig{Enabled: true, Yellow: 1000, Red: 1400}
+	if got != want {
+		t.Fatalf("invalid buzzer config: got=%+v, want=%+v", got, want)
+	}
+
+	f.chars[uuidReadSensorState][1] = 0x00
+	got, err = dev.BuzzerConfig()
+	if err != nil {
+		t.Fatalf("could not read buzzer config: %+v", err)
+	}
+	if got.Enabled {
+		t.Fatalf("invalid buzzer config: got=%+v, want disabled buzzer", got)
+	}
+}
+
+func TestBuzzerConfigFirmware(t *testing.T) {
+	f := newFakeClient()
+	f.chars[uuidReadSensorState] = []byte{0xf1, 0x01, 0x00}
+	dev := newFakeDevice(f)
+
+	_, err := dev.BuzzerConfig()
+	if !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("invalid error: got=%+v, want=%v", err, errors.ErrUnsupported)
+	}
+	err = dev.SetBuzzerConfig(BuzzerConfig{Enabled: true, Yellow: 1000, Red: 1400})
+	if !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("invalid error: got=%+v, want=%v", err, errors.ErrUnsupported)
+	}
+	if len(f.writes) != 0 {
+		t.Fatalf("buzzer commands sent to an unsupported firmware: %x", f.writes)
+	}
+}
+
+func TestBuzzerConfigValidate(t *testing.T) {
+	for _, tc := range []struct {
+		cfg BuzzerConfig
+		ok  bool
+	}{
+		{BuzzerConfig{Yellow: 1000, Red: 1400}, true},
+		{BuzzerConfig{Yellow: 400, Red: 9999}, true},
+		{BuzzerConfig{Yellow: 399, Red: 1400}, false},
+		{BuzzerConfig{Yellow: 1000, Red: 10000}, false},
+		{BuzzerConfig{Yellow: 10000, Red: 1400}, false},
+		{BuzzerConfig{Yellow: 1000, Red: 399}, false},
+		{BuzzerConfig{Yellow: 1400, Red: 1400}, false},
+		{BuzzerConfig{Yellow: 1400, Red: 1000}, false},
+	} {
+		err := tc.cfg.Validate()
+		if ok := err == nil; ok != tc.ok {
+			t.Errorf("invalid validation of %+v: got=%v, want ok=%v", tc.cfg, err, tc.ok)
+		}
+	}
+}
+
+func TestSetBuzzerConfig(t *testing.T) {
+	f := newFakeClient()
+	f.chars[uuidReadSensorState] = []byte{0xf1, 0x00, 0x00, 0xe8, 0x03, 0x78, 0x05}
+	dev := newFakeDevice(f)
+
+	err := dev.SetBuzzerConfig(BuzzerConfig{Enabled: true, Yellow: 800, Red: 1200})
+	if err != nil {
+		t.Fatalf("could not set buzzer config: %+v", err)
+	}
+	want := [][]byte{
+		{0x96, 0x20, 0x03, 0xb0, 0x04}, // thresholds: 800 and 1200 ppm
+		{0x94, 0x01},                   // buzzer enabled
+	}
+	if len(f.writes) != len(want) {
+		t.Fatalf("invalid number of commands: got=%x, want=%x", f.writes, want)
+	}
+	for i := range want {
+		if !bytes.Equal(f.writes[i], want[i]) {
+			t.Fatalf("invalid command #%d: got=%x, want=%x", i, f.writes[i], want[i])
+		}
+	}
+
+	err = dev.SetBuzzerConfig(BuzzerConfig{Yellow: 1400, Red: 1000})
+	if err == nil {
+		t.Fatalf("expected an error for invalid thresholds")
+	}
+	if len(f.writes) != len(want) {
+		t.Fatalf("invalid thresholds written: %x", f.writes[len(want):])
+	}
+}